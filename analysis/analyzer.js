@@ -1,19 +1,115 @@
 // analyzers/ts/index.js
-const ts = require('typescript');
+// 用法:
+//   node analyzer.js <file>    单文件模式，输出该文件的 Chunks JSON 数组
+//   node analyzer.js --server  常驻模式，stdin/stdout 逐行 JSON (NDJSON):
+//                              请求 {"id":1,"path":"a.ts","content":"(可选)"} -> 响应 {"id":1,"chunks":[...]} 或 {"id":1,"error":"..."}
+//                              语法检查 {"id":2,"path":"a.ts","content":"...","check":true} -> 响应 {"id":2,"diagnostics":[{"line":1,"column":5,"message":"..."}]}
 const fs = require('fs');
+const path = require('path');
+const readline = require('readline');
 
-// 1. 获取目标文件路径 (从命令行参数)
-const targetFile = process.argv[2];
-if (!targetFile) {
-    console.error("Error: No target file provided");
-    process.exit(1);
+// 脚本可能被 Go 端从 go:embed 释放到临时目录，因此依次从工作目录、脚本目录查找 typescript，
+// 都找不到时退回默认解析 (NODE_PATH / 全局安装)
+function loadTypeScript() {
+    try {
+        return require(require.resolve('typescript', { paths: [process.cwd(), __dirname] }));
+    } catch (e) {
+        return require('typescript');
+    }
 }
+const ts = loadTypeScript();
+
+// React 组件常见的包装调用: export const Foo = memo(() => ...)
+const componentWrappers = new Set(['memo', 'forwardRef', 'observer', 'React.memo', 'React.forwardRef']);
 
-try {
-    // 2. 读取文件内容 (只读，不修改)
-    const sourceCode = fs.readFileSync(targetFile, 'utf-8');
+// unwrapFunction 返回变量初始化表达式中的函数节点 (箭头函数、函数表达式或被组件包装的函数)
+function unwrapFunction(expr) {
+    while (expr && (ts.isParenthesizedExpression(expr) || ts.isAsExpression(expr) ||
+        (ts.isSatisfiesExpression && ts.isSatisfiesExpression(expr)))) {
+        expr = expr.expression;
+    }
+    if (!expr) {
+        return null;
+    }
+    if (ts.isArrowFunction(expr) || ts.isFunctionExpression(expr)) {
+        return expr;
+    }
+    if (ts.isCallExpression(expr) && componentWrappers.has(expr.expression.getText())) {
+        for (const arg of expr.arguments) {
+            const fn = unwrapFunction(arg);
+            if (fn) {
+                return fn;
+            }
+        }
+    }
+    return null;
+}
 
-    // 3. 创建 SourceFile 对象 (这是 TS 编译器的内存对象，不依赖 tsconfig)
+// resolveModule 将相对模块说明符解析为源文件路径 (与 fromFile 的相对/绝对写法一致)，
+// 非相对模块 (npm 包、tsconfig paths 别名) 返回 null
+function resolveModule(fromFile, spec) {
+    if (!spec.startsWith('.')) {
+        return null;
+    }
+    const base = path.join(path.dirname(fromFile), spec);
+    // ESM 风格的 "./foo.js" 实际指向 foo.ts
+    const stem = base.replace(/\.(js|jsx)$/, '');
+    const candidates = [base, stem + '.ts', stem + '.tsx', stem + '.d.ts', path.join(base, 'index.ts'), path.join(base, 'index.tsx')];
+    for (const candidate of candidates) {
+        try {
+            if (fs.statSync(candidate).isFile()) {
+                return candidate;
+            }
+        } catch (e) {
+            // 不存在，继续尝试下一个
+        }
+    }
+    return null;
+}
+
+// collectFileScope 收集文件级上下文: 顶层声明名与 import 绑定
+// imports: 本地名 -> { module, name ('default' / '*' / 导出名), resolved (解析出的文件路径或 null) }
+function collectFileScope(sourceFile, targetFile) {
+    const topLevel = new Set();
+    const imports = new Map();
+    for (const stmt of sourceFile.statements) {
+        if (ts.isImportDeclaration(stmt) && ts.isStringLiteral(stmt.moduleSpecifier) && stmt.importClause) {
+            const module = stmt.moduleSpecifier.text;
+            const resolved = resolveModule(targetFile, module);
+            const clause = stmt.importClause;
+            if (clause.name) {
+                imports.set(clause.name.text, { module, name: 'default', resolved });
+            }
+            const bindings = clause.namedBindings;
+            if (bindings && ts.isNamespaceImport(bindings)) {
+                imports.set(bindings.name.text, { module, name: '*', resolved });
+            } else if (bindings && ts.isNamedImports(bindings)) {
+                for (const el of bindings.elements) {
+                    const imported = el.propertyName ? el.propertyName.text : el.name.text;
+                    imports.set(el.name.text, { module, name: imported, resolved });
+                }
+            }
+        } else if (ts.isVariableStatement(stmt)) {
+            for (const decl of stmt.declarationList.declarations) {
+                if (ts.isIdentifier(decl.name)) {
+                    topLevel.add(decl.name.text);
+                }
+            }
+        } else if (stmt.name && ts.isIdentifier(stmt.name)) {
+            // function / class / interface / type / enum
+            topLevel.add(stmt.name.text);
+        }
+    }
+    return { topLevel, imports };
+}
+
+// analyzeFile 解析单个文件，返回 Chunks 数组
+// content 为空时从磁盘读取；editing 定位时传入内存中的内容
+function analyzeFile(targetFile, content) {
+    // 读取文件内容 (只读，不修改)
+    const sourceCode = typeof content === 'string' ? content : fs.readFileSync(targetFile, 'utf-8');
+
+    // 创建 SourceFile 对象 (这是 TS 编译器的内存对象，不依赖 tsconfig)
     const sourceFile = ts.createSourceFile(
         targetFile,
         sourceCode,
@@ -22,65 +118,324 @@ try {
     );
 
     const chunks = [];
+    const { topLevel, imports } = collectFileScope(sourceFile, targetFile);
+
+    // importRefs 将 import 绑定转为引用符号:
+    // 相对模块 -> "resolvedPath:Name" (与目标 Chunk 的 "path:Name" 符号对应)；
+    // npm 包 -> "module:Name"；tsconfig 别名 ("@/..." 等) 无法解析，额外保留裸名作为脏链接
+    function importRefs(imp, member) {
+        // 默认导出无法得知原名，按惯例假定与本地名相同
+        if (imp.resolved) {
+            return [`${imp.resolved}:${member}`];
+        }
+        const refs = [`${imp.module}:${member}`];
+        if (imp.module.startsWith('@/') || imp.module.startsWith('~/')) {
+            refs.push(member);
+        }
+        return refs;
+    }
+
+    // identifierRefs 标识符只有指向顶层声明或 import 时才构成依赖
+    function identifierRefs(name) {
+        const imp = imports.get(name);
+        if (imp) {
+            return imp.name === '*' ? [] : importRefs(imp, imp.name === 'default' ? name : imp.name);
+        }
+        if (topLevel.has(name)) {
+            return [`${targetFile}:${name}`];
+        }
+        return [];
+    }
+
+    // collectRefs 从编译器 AST 提取引用: 标识符 (调用、类型引用、JSX 标签、值引用)、
+    // 命名空间成员 (ns.foo)、this.member 与调用位置上的方法名 (obj.save())
+    // 字符串、注释与 JSX 文本不再产生引用
+    // usedImports 收集引用到的 import 本地名，供生成 Chunk 的 imports
+    function collectRefs(root, selfName, className, usedImports) {
+        const refs = new Set();
+        const add = (list) => list.forEach(r => refs.add(r));
 
-    // 4. 遍历 AST
+        function walk(n) {
+            const parent = n.parent;
+            if (ts.isIdentifier(n)) {
+                // 跳过声明名、属性名、成员名位置 ({ foo } 简写属性除外，它引用同名变量)
+                const isNamePosition = parent && (parent.name === n || (ts.isQualifiedName(parent) && parent.right === n));
+                if (!isNamePosition || ts.isShorthandPropertyAssignment(parent)) {
+                    add(identifierRefs(n.text));
+                    if (imports.has(n.text)) {
+                        usedImports.add(n.text);
+                    }
+                }
+            } else if (ts.isPropertyAccessExpression(n) || ts.isQualifiedName(n)) {
+                const object = ts.isPropertyAccessExpression(n) ? n.expression : n.left;
+                const member = ts.isPropertyAccessExpression(n) ? n.name.text : n.right.text;
+                const imp = ts.isIdentifier(object) ? imports.get(object.text) : null;
+                if (imp && imp.name === '*') {
+                    add(importRefs(imp, member));
+                    usedImports.add(object.text);
+                } else if (object.kind === ts.SyntaxKind.ThisKeyword && className) {
+                    refs.add(`${targetFile}:${className}.${member}`);
+                } else if (parent && ts.isCallExpression(parent) && parent.expression === n && member.length > 2) {
+                    refs.add(member);
+                }
+            }
+            ts.forEachChild(n, walk);
+        }
+        walk(root);
+
+        refs.delete(`${targetFile}:${selfName}`);
+        return [...refs].sort();
+    }
+
+    // heritageRefs 提取 class/interface 的 implements 与 extends 目标，符号规则与引用一致；
+    // 无法解析的 (全局或未导入的) 名字保留原文
+    function heritageRefs(node) {
+        const result = new Set();
+        for (const clause of node.heritageClauses || []) {
+            for (const t of clause.types) {
+                const expr = t.expression;
+                let refs = [];
+                if (ts.isIdentifier(expr)) {
+                    refs = identifierRefs(expr.text);
+                } else if (ts.isPropertyAccessExpression(expr) && ts.isIdentifier(expr.expression)) {
+                    const imp = imports.get(expr.expression.text);
+                    if (imp && imp.name === '*') {
+                        refs = importRefs(imp, expr.name.text);
+                    }
+                }
+                if (refs.length === 0) {
+                    refs = [expr.getText(sourceFile)];
+                }
+                refs.forEach(r => result.add(r));
+            }
+        }
+        return [...result].sort();
+    }
+
+    // importLines 按模块合并本地名，生成独立的 import 语句 (只含用到的绑定)
+    function importLines(localNames) {
+        const byModule = new Map();
+        for (const local of localNames) {
+            const imp = imports.get(local);
+            if (!byModule.has(imp.module)) {
+                byModule.set(imp.module, { def: null, ns: null, named: [] });
+            }
+            const group = byModule.get(imp.module);
+            if (imp.name === 'default') {
+                group.def = local;
+            } else if (imp.name === '*') {
+                group.ns = local;
+            } else {
+                group.named.push(imp.name === local ? local : `${imp.name} as ${local}`);
+            }
+        }
+
+        const lines = [];
+        for (const [module, group] of byModule) {
+            // 命名空间导入不能与具名导入写在同一条语句里
+            if (group.ns) {
+                lines.push(`import * as ${group.ns} from '${module}';`);
+            }
+            const parts = [];
+            if (group.def) {
+                parts.push(group.def);
+            }
+            if (group.named.length > 0) {
+                parts.push(`{ ${group.named.sort().join(', ')} }`);
+            }
+            if (parts.length > 0) {
+                lines.push(`import ${parts.join(', ')} from '${module}';`);
+            }
+        }
+        return lines.sort();
+    }
+
+    // JS 字符串下标是 UTF-16 码元，Go 端按字节切片，需换算
+    function byteOffset(pos) {
+        return Buffer.byteLength(sourceCode.substring(0, pos), 'utf8');
+    }
+
+    // 生成骨架 (Skeleton)
+    // 策略：函数体替换为 "{ ... }" (表达式体替换为 "...")，签名与包装调用保留
+    function skeletonOf(start, end, fn) {
+        const text = sourceCode.substring(start, end);
+        if (!fn || !fn.body) {
+            return text;
+        }
+        const bodyStart = fn.body.getStart(sourceFile);
+        const bodyEnd = fn.body.getEnd();
+        const placeholder = ts.isBlock(fn.body) ? "{ ... }" : "...";
+        return sourceCode.substring(start, bodyStart) + placeholder + sourceCode.substring(bodyEnd, end);
+    }
+
+    function pushChunk(name, chunkType, node, fn) {
+        const start = node.getStart(sourceFile);
+        const end = node.getEnd();
+        const body = sourceCode.substring(start, end);
+
+        // 提取链接 (Symbols): this.member 需要所属类名
+        let className = null;
+        if (ts.isClassLike(node) && node.name) {
+            className = node.name.text;
+        } else if (node.parent && ts.isClassLike(node.parent) && node.parent.name) {
+            className = node.parent.name.text;
+        }
+        const usedImports = new Set();
+        const refs = collectRefs(node, name, className, usedImports);
+
+        chunks.push({
+            name: name,
+            type: chunkType, // 字符串类型
+            skeleton: skeletonOf(start, end, fn),
+            body: body,
+            symbols_referenced: refs,
+            imports: importLines(usedImports),
+            implements: heritageRefs(node),
+            start: byteOffset(start),
+            end: byteOffset(end)
+        });
+    }
+
+    // 方法名带上所属类: Class.method (ID 与重名序号由 Go 端统一分配)
+    function memberName(node) {
+        const name = node.name ? node.name.getText(sourceFile) : 'anonymous';
+        if (node.parent && ts.isClassLike(node.parent) && node.parent.name) {
+            return `${node.parent.name.text}.${name}`;
+        }
+        return name;
+    }
+
+    // 文件头: 开头连续的指令 ('use client' 等) 与 import 语句，区间从文件起始处算起 (含开头注释)
+    function pushHeader() {
+        const directives = [];
+        const importStmts = [];
+        let end = -1;
+        for (const stmt of sourceFile.statements) {
+            if (ts.isExpressionStatement(stmt) && ts.isStringLiteral(stmt.expression)) {
+                directives.push(stmt.getText(sourceFile));
+            } else if (ts.isImportDeclaration(stmt) || ts.isImportEqualsDeclaration(stmt)) {
+                importStmts.push(stmt.getText(sourceFile));
+            } else {
+                break;
+            }
+            end = stmt.getEnd();
+        }
+        if (end < 0) {
+            return;
+        }
+        chunks.push({
+            name: '@header',
+            type: "Header",
+            skeleton: directives.join('\n'),
+            body: sourceCode.substring(0, end),
+            symbols_referenced: [],
+            imports: importStmts,
+            start: 0,
+            end: byteOffset(end)
+        });
+    }
+
+    // 遍历 AST
     function visit(node) {
-        let chunkType = null;
-        
         // 识别关键节点并赋予字符串类型
         if (ts.isFunctionDeclaration(node)) {
-            chunkType = "Function";
+            pushChunk(node.name ? node.name.text : 'anonymous', "Function", node, node);
         } else if (ts.isMethodDeclaration(node)) {
-            chunkType = "Method";
+            pushChunk(memberName(node), "Method", node, node);
+        } else if (ts.isPropertyDeclaration(node) && ts.isClassLike(node.parent) && unwrapFunction(node.initializer)) {
+            // 类字段箭头函数: handleClick = () => { ... }
+            pushChunk(memberName(node), "Method", node, unwrapFunction(node.initializer));
         } else if (ts.isClassDeclaration(node)) {
-            chunkType = "Class";
+            pushChunk(node.name ? node.name.text : 'anonymous', "Class", node, null);
         } else if (ts.isInterfaceDeclaration(node)) {
-            chunkType = "Interface";
-        }
-
-        if (chunkType) {
-            const name = node.name ? node.name.text : 'anonymous';
-            const start = node.getStart();
-            const end = node.getEnd();
-            const body = sourceCode.substring(start, end);
-
-            // 生成骨架 (Skeleton)
-            // 策略：如果是函数/方法，把大括号里的内容替换为 " ... "
-            let skeleton = body;
-            if (ts.isFunctionDeclaration(node) || ts.isMethodDeclaration(node)) {
-                // 查找第一个 '{' 和最后一个 '}'
-                const firstBrace = body.indexOf('{');
-                const lastBrace = body.lastIndexOf('}');
-                if (firstBrace !== -1 && lastBrace !== -1) {
-                    skeleton = body.substring(0, firstBrace + 1) + " ... " + body.substring(lastBrace);
+            pushChunk(node.name.text, "Interface", node, null);
+        } else if (ts.isTypeAliasDeclaration(node)) {
+            pushChunk(node.name.text, "Type", node, null);
+        } else if (ts.isEnumDeclaration(node)) {
+            pushChunk(node.name.text, "Enum", node, null);
+        } else if (ts.isVariableStatement(node) && (ts.isSourceFile(node.parent) || ts.isModuleBlock(node.parent))) {
+            // 顶层 const 函数/组件: export const Foo = () => { ... }
+            // 只有一个声明时 Chunk 覆盖整条语句 (含 export const)，否则覆盖单个声明
+            const decls = node.declarationList.declarations;
+            for (const decl of decls) {
+                const fn = unwrapFunction(decl.initializer);
+                if (fn && ts.isIdentifier(decl.name)) {
+                    pushChunk(decl.name.text, "Function", decls.length === 1 ? node : decl, fn);
                 }
             }
-
-            // 提取脏链接 (Symbols)
-            // 简单正则提取，忽略 JS 关键字
-            const words = body.match(/[a-zA-Z_]\w+/g) || [];
-            const keywords = new Set(['function', 'const', 'let', 'var', 'return', 'if', 'else', 'for', 'class', 'interface', 'import', 'export', 'from', 'null', 'undefined', 'true', 'false', 'new', 'this', 'public', 'private', 'protected', 'try', 'catch', 'finally', 'switch', 'case', 'break', 'continue']);
-            const refs = [...new Set(words)].filter(w => !keywords.has(w) && w.length > 2);
-
-            chunks.push({
-                id: `${targetFile}:${name}`,
-                type: chunkType, // 字符串类型
-                skeleton: skeleton,
-                body: body,
-                symbols_referenced: refs
-            });
         }
         ts.forEachChild(node, visit);
     }
 
+    pushHeader();
     visit(sourceFile);
+    return chunks;
+}
 
-    // 5. 输出标准 JSON 到 Stdout
-    console.log(JSON.stringify(chunks));
+// checkSyntax 只做语法检查 (不解析 import、不做类型检查)，返回 [{line, column, message}]，行列从 1 开始
+// transpileModule 报告的是单文件的语法诊断，.tsx/.jsx 按扩展名启用 JSX
+function checkSyntax(targetFile, content) {
+    const sourceCode = typeof content === 'string' ? content : fs.readFileSync(targetFile, 'utf-8');
+    const result = ts.transpileModule(sourceCode, {
+        fileName: targetFile,
+        reportDiagnostics: true,
+        compilerOptions: { allowJs: true, jsx: ts.JsxEmit.Preserve },
+    });
+    return (result.diagnostics || [])
+        .filter((d) => d.category === ts.DiagnosticCategory.Error)
+        .map((d) => {
+            const message = ts.flattenDiagnosticMessageText(d.messageText, '\n');
+            if (!d.file || d.start === undefined) {
+                return { line: 0, column: 0, message };
+            }
+            const { line, character } = d.file.getLineAndCharacterOfPosition(d.start);
+            return { line: line + 1, column: character + 1, message };
+        });
+}
 
-} catch (e) {
-    // 捕获所有错误，输出空数组，保证 Go 端不崩
-    console.error(`Analyzer Error: ${e.message}`);
-    console.log("[]");
-    process.exit(0); // 正常退出，让 Go 继续处理下一个
-}
\ No newline at end of file
+function runServer() {
+    const rl = readline.createInterface({ input: process.stdin, terminal: false });
+    rl.on('line', (line) => {
+        if (!line.trim()) {
+            return;
+        }
+        let req;
+        try {
+            req = JSON.parse(line);
+        } catch (e) {
+            process.stdout.write(JSON.stringify({ id: 0, error: `bad request: ${e.message}` }) + '\n');
+            return;
+        }
+        let resp;
+        try {
+            resp = req.check
+                ? { id: req.id, diagnostics: checkSyntax(req.path, req.content) }
+                : { id: req.id, chunks: analyzeFile(req.path, req.content) };
+        } catch (e) {
+            // 单个文件失败不影响进程，继续服务后续请求
+            resp = { id: req.id, error: e.message };
+        }
+        process.stdout.write(JSON.stringify(resp) + '\n');
+    });
+    rl.on('close', () => process.exit(0));
+}
+
+const arg = process.argv[2];
+if (arg === '--server') {
+    runServer();
+} else {
+    // 单文件模式 (便于手动调试)
+    if (!arg) {
+        console.error("Error: No target file provided");
+        process.exit(1);
+    }
+    try {
+        // 输出标准 JSON 到 Stdout
+        console.log(JSON.stringify(analyzeFile(arg)));
+    } catch (e) {
+        // 捕获所有错误，输出空数组，保证 Go 端不崩
+        console.error(`Analyzer Error: ${e.message}`);
+        console.log("[]");
+        process.exit(0); // 正常退出，让 Go 继续处理下一个
+    }
+}
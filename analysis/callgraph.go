@@ -0,0 +1,106 @@
+package analysis
+
+import (
+	"fmt"
+
+	"sysevov2/storage"
+
+	"github.com/samber/lo"
+)
+
+// Callers 返回引用了该 Chunk 所定义符号的 Chunk (调用方)，不含自身
+func Callers(chunkID string) ([]string, error) {
+	chunk, err := storage.ChunkStorage.HGet(chunkID)
+	if err != nil || chunk == nil {
+		return nil, fmt.Errorf("chunk not found: %s", chunkID)
+	}
+	ids, err := storage.Indexer.GetReferrers(chunk.SymbolsDefined)
+	if err != nil {
+		return nil, err
+	}
+	return lo.Without(ids, chunkID), nil
+}
+
+// Callees 返回该 Chunk 引用的符号所对应的定义 Chunk (被调用方)，不含自身
+func Callees(chunkID string) ([]string, error) {
+	chunk, err := storage.ChunkStorage.HGet(chunkID)
+	if err != nil || chunk == nil {
+		return nil, fmt.Errorf("chunk not found: %s", chunkID)
+	}
+	ids, err := storage.Indexer.GetUnionLinks(chunk.SymbolsReferenced)
+	if err != nil {
+		return nil, err
+	}
+	return lo.Without(ids, chunkID), nil
+}
+
+// Implementations 返回实现/继承了该 Chunk 所定义接口或基类的 Chunk
+func Implementations(chunkID string) ([]string, error) {
+	chunk, err := storage.ChunkStorage.HGet(chunkID)
+	if err != nil || chunk == nil {
+		return nil, fmt.Errorf("chunk not found: %s", chunkID)
+	}
+	ids, err := storage.Indexer.GetImplementers(chunk.SymbolsDefined)
+	if err != nil {
+		return nil, err
+	}
+	return lo.Without(ids, chunkID), nil
+}
+
+// Interfaces 返回该 Chunk 实现/继承的接口或基类所对应的定义 Chunk
+func Interfaces(chunkID string) ([]string, error) {
+	chunk, err := storage.ChunkStorage.HGet(chunkID)
+	if err != nil || chunk == nil {
+		return nil, fmt.Errorf("chunk not found: %s", chunkID)
+	}
+	ids, err := storage.Indexer.GetUnionLinks(chunk.Implements)
+	if err != nil {
+		return nil, err
+	}
+	return lo.Without(ids, chunkID), nil
+}
+
+// CallersClosure 从 roots 出发沿调用方向外扩展 depth 层
+// 返回: ChunkID -> 跳数 (roots 自身不计入)
+func CallersClosure(roots []string, depth int) map[string]int {
+	return closure(roots, depth, Callers)
+}
+
+// CalleesClosure 从 roots 出发沿被调用方向外扩展 depth 层
+// 返回: ChunkID -> 跳数 (roots 自身不计入)
+func CalleesClosure(roots []string, depth int) map[string]int {
+	return closure(roots, depth, Callees)
+}
+
+// closure 广度优先遍历；单个节点查询失败 (如 Chunk 已被删除) 时跳过该节点
+func closure(roots []string, depth int, next func(string) ([]string, error)) map[string]int {
+	visited := make(map[string]int)
+	for _, id := range roots {
+		visited[id] = 0
+	}
+
+	frontier := roots
+	for hop := 1; hop <= depth && len(frontier) > 0; hop++ {
+		var nextFrontier []string
+		for _, id := range frontier {
+			neighbors, err := next(id)
+			if err != nil {
+				fmt.Printf("⚠️ Call graph lookup failed for %s: %v\n", id, err)
+				continue
+			}
+			for _, n := range neighbors {
+				if _, seen := visited[n]; seen {
+					continue
+				}
+				visited[n] = hop
+				nextFrontier = append(nextFrontier, n)
+			}
+		}
+		frontier = nextFrontier
+	}
+
+	for _, id := range roots {
+		delete(visited, id)
+	}
+	return visited
+}
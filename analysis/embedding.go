@@ -0,0 +1,61 @@
+package analysis
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+
+	"sysevov2/config"
+	"sysevov2/models"
+	"sysevov2/storage"
+	"sysevov2/utils"
+)
+
+// maxEmbeddingTextLen 单个 Chunk 送去计算向量的最大字符数
+const maxEmbeddingTextLen = 2000
+
+// chunkEmbedder 为变更的 Chunk 计算语义向量
+// 向量的 ContentHash 与 Chunk 一致时跳过；服务不可用时本轮索引不再重试
+type chunkEmbedder struct {
+	disabled atomic.Bool
+}
+
+func newChunkEmbedder() *chunkEmbedder {
+	e := &chunkEmbedder{}
+	e.disabled.Store(!config.Indexer.Embeddings)
+	return e
+}
+
+func (e *chunkEmbedder) refresh(chunks []*models.Chunk) {
+	for _, chunk := range chunks {
+		if e.disabled.Load() {
+			return
+		}
+		// 文件头不参与语义检索
+		if chunk.Type == models.ChunkTypeHeader {
+			continue
+		}
+		if old, err := storage.ChunkEmbeddingKey.HGet(chunk.ID); err == nil && old != nil && old.ContentHash == chunk.ContentHash {
+			continue
+		}
+
+		vector, err := utils.GetEmbedding(embeddingText(chunk))
+		if err != nil {
+			fmt.Printf("⚠️ Embedding unavailable, skipping for this run: %v\n", err)
+			e.disabled.Store(true)
+			return
+		}
+		if _, err := storage.ChunkEmbeddingKey.HSet(chunk.ID, &models.ChunkEmbedding{ContentHash: chunk.ContentHash, Vector: vector}); err != nil {
+			fmt.Printf("❌ DB Error: %v\n", err)
+		}
+	}
+}
+
+// embeddingText 与 L1 候选展示的内容一致: ID + Skeleton
+func embeddingText(chunk *models.Chunk) string {
+	text := chunk.ID + "\n" + chunk.Skeleton
+	if len(text) > maxEmbeddingTextLen {
+		text = strings.ToValidUTF8(text[:maxEmbeddingTextLen], "")
+	}
+	return text
+}
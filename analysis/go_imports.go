@@ -0,0 +1,103 @@
+package analysis
+
+import (
+	"go/ast"
+	"go/types"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// goImportTable 文件的 import 表，用于计算单个 Chunk 用到的 import 语句
+type goImportTable struct {
+	byName map[string]string // 包名 (别名或推测的默认包名) -> import 语句
+	byPath map[string]string // 导入路径 -> import 语句 (类型检查模式使用)
+	all    []string          // 按声明顺序的全部 import 语句
+}
+
+func newGoImportTable(file *ast.File) *goImportTable {
+	table := &goImportTable{byName: make(map[string]string), byPath: make(map[string]string)}
+	for _, spec := range file.Imports {
+		importPath, err := strconv.Unquote(spec.Path.Value)
+		if err != nil {
+			continue
+		}
+		line := goImportLine(spec)
+		table.all = append(table.all, line)
+		table.byPath[importPath] = line
+
+		name := guessGoPackageName(importPath)
+		if spec.Name != nil {
+			name = spec.Name.Name
+		}
+		// 空白导入与点导入无法按选择器匹配
+		if name != "_" && name != "." {
+			table.byName[name] = line
+		}
+	}
+	return table
+}
+
+// goImportLine 将 import spec 转为独立语句: import cfgredis "github.com/doptime/config/cfgredis"
+func goImportLine(spec *ast.ImportSpec) string {
+	if spec.Name != nil {
+		return "import " + spec.Name.Name + " " + spec.Path.Value
+	}
+	return "import " + spec.Path.Value
+}
+
+var goMajorVersionSuffix = regexp.MustCompile(`^v[0-9]+$`)
+
+// guessGoPackageName 按惯例由导入路径推测包名: "github.com/cespare/xxhash/v2" -> "xxhash",
+// "github.com/sashabaranov/go-openai" -> "openai"；类型检查模式下以实际包名为准
+func guessGoPackageName(importPath string) string {
+	name := path.Base(importPath)
+	if goMajorVersionSuffix.MatchString(name) {
+		name = path.Base(path.Dir(importPath))
+	}
+	name = strings.TrimPrefix(name, "go-")
+	name = strings.TrimSuffix(strings.TrimSuffix(name, "-go"), ".go")
+	return strings.ReplaceAll(name, "-", "")
+}
+
+// used 返回节点内引用到的 import 语句 (按字典序)
+func (t *goImportTable) used(node ast.Node, typed *goTypedInfo) []string {
+	lines := make(map[string]struct{})
+	ast.Inspect(node, func(n ast.Node) bool {
+		sel, ok := n.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		ident, ok := sel.X.(*ast.Ident)
+		if !ok {
+			return true
+		}
+		if typed != nil {
+			if pkgName, ok := typed.info.Uses[ident].(*types.PkgName); ok {
+				if line, ok := t.byPath[pkgName.Imported().Path()]; ok {
+					lines[line] = struct{}{}
+				}
+			}
+			return true
+		}
+		// 无类型信息: 未解析到本地对象的标识符才可能是包名
+		if ident.Obj == nil {
+			if line, ok := t.byName[ident.Name]; ok {
+				lines[line] = struct{}{}
+			}
+		}
+		return true
+	})
+
+	if len(lines) == 0 {
+		return nil
+	}
+	list := make([]string, 0, len(lines))
+	for line := range lines {
+		list = append(list, line)
+	}
+	sort.Strings(list)
+	return list
+}
@@ -9,18 +9,23 @@ import (
 	"go/token"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"sysevov2/models"
+	"sysevov2/search"
 	"sysevov2/storage"
+	"sysevov2/utils"
 )
 
 // RunParallelIndexing 并发执行索引构建
 // roots: 根目录列表 (e.g. ["./backend", "./frontend"])
 // numThreads: 并发协程数
-func RunParallelIndexing(roots []string, numThreads int) error {
+// 返回所有 root 合并后的 Chunk 变更统计
+func RunParallelIndexing(roots []string, numThreads int) (*IndexReport, error) {
 	if numThreads <= 0 {
 		numThreads = 1
 	}
@@ -30,6 +35,11 @@ func RunParallelIndexing(roots []string, numThreads int) error {
 	semaphore := make(chan struct{}, numThreads)
 	// 用于捕获并发过程中的错误
 	errChan := make(chan error, len(roots))
+	report := &IndexReport{}
+
+	// TS sidecar 进程数与并发度一致，结束后关闭
+	resetTSPool(numThreads)
+	defer shutdownTSPool()
 
 	fmt.Printf("🚀 Starting parallel indexing with %d threads...\n", numThreads)
 
@@ -44,27 +54,41 @@ func RunParallelIndexing(roots []string, numThreads int) error {
 
 			fmt.Printf("🧵 Thread processing: %s\n", path)
 
-			if err := RunIncrementalIndexing(path); err != nil {
+			rootReport, err := RunIncrementalIndexing(path)
+			if err != nil {
 				fmt.Printf("❌ Error indexing %s: %v\n", path, err)
 				errChan <- err
 			}
+			report.Merge(rootReport)
 		}(root)
 	}
 
 	wg.Wait()
 	close(errChan)
 
+	// 清理不在任何已配置 root 下的文件 (例如 root 被移出配置前索引过的文件)
+	report.Merge(&IndexReport{Removed: newStaleCollector().pruneOutsideRoots(roots)})
+
+	fmt.Printf("📊 Index report: %s\n", report)
 	if len(errChan) > 0 {
-		return fmt.Errorf("parallel indexing completed with %d errors", len(errChan))
+		return report, fmt.Errorf("parallel indexing completed with %d errors", len(errChan))
 	}
 
 	fmt.Println("✅ Parallel indexing finished successfully.")
-	return nil
+	return report, nil
 }
 
 // RunIncrementalIndexing 执行单目录的增量代码分析与索引构建
-func RunIncrementalIndexing(projectRoot string) error {
-	return filepath.Walk(projectRoot, func(path string, info os.FileInfo, err error) error {
+// 增量依据是文件内容哈希而非 mtime：同一秒内的修改、git checkout 还原的旧 mtime、
+// 新 clone 的仓库都能得到正确结果；文件内只有哈希变化的 Chunk 会被重写
+func RunIncrementalIndexing(projectRoot string) (*IndexReport, error) {
+	report := &IndexReport{}
+
+	// 1. 扫描并做增量检查，收集需要重新索引的文件
+	var changed []string
+	fileHashes := make(map[string]string)
+	fileContents := make(map[string][]byte)
+	err := filepath.Walk(projectRoot, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
@@ -76,37 +100,77 @@ func RunIncrementalIndexing(projectRoot string) error {
 			return nil
 		}
 
-		ext := filepath.Ext(path)
-		if ext != ".go" && ext != ".ts" && ext != ".tsx" {
+		// 只处理已注册且启用了解析器的文件
+		if _, ok := parserFor(path); !ok {
 			return nil
 		}
 
-		// 2. 增量检查 (Check Metadata)
-		lastMod, _ := storage.FileMetaKey.HGet(path)
-		if info.ModTime().Unix() <= lastMod {
+		// 增量检查 (Check Metadata): 比较内容哈希
+		content, err := os.ReadFile(path)
+		if err != nil {
+			fmt.Printf("⚠️ Read Error %s: %v\n", path, err)
+			return nil
+		}
+		hash := utils.ContentHash(content)
+		if meta, err := storage.FileMetaKey.HGet(path); err == nil && meta != nil && meta.ContentHash == hash && meta.Schema == indexSchemaVersion {
 			return nil // 跳过未修改文件
 		}
+		changed = append(changed, path)
+		fileHashes[path] = hash
+		fileContents[path] = content
+		return nil
+	})
+	if err != nil {
+		return report, err
+	}
+
+	// 2. 需要跨文件上下文的解析器 (如类型检查模式的 Go) 先整体加载
+	prepareParsers(projectRoot, changed)
+	defer finishParsers(projectRoot)
 
+	gc := newStaleCollector()
+	embedder := newChunkEmbedder()
+	for _, path := range changed {
 		fmt.Printf("🔍 Indexing: %s\n", path)
 
 		// 3. 解析代码 (Parse)
-		var chunks []*models.Chunk
-		var parseErr error
-
-		if ext == ".go" {
-			chunks, parseErr = ParseGoFile(path)
-		} else {
-			// 假设 ParseTSFile 在同包下的 parser_ts_sidecar.go 中定义
-			chunks, parseErr = ParseTSFile(path)
+		langParser, ok := parserFor(path)
+		if !ok {
+			continue
 		}
-
+		chunks, parseErr := langParser.Parse(path, fileContents[path])
+		delete(fileContents, path)
 		if parseErr != nil {
 			fmt.Printf("⚠️ Parse Error %s: %v\n", path, parseErr)
-			return nil
+			continue
 		}
 
-		// 4. 存储与索引 (Store & Index)
+		// 4. 计算 Chunk 哈希并与上次结果比对
+		prevHashes := gc.previousChunkHashes(path)
+		newHashes := make(map[string]string, len(chunks))
+		var dirty []*models.Chunk
 		for _, chunk := range chunks {
+			chunk.ContentHash = chunkContentHash(chunk)
+			newHashes[chunk.ID] = chunk.ContentHash
+			if prevHash, existed := prevHashes[chunk.ID]; !existed {
+				report.Added = append(report.Added, chunk.ID)
+				dirty = append(dirty, chunk)
+			} else if prevHash != chunk.ContentHash {
+				report.Changed = append(report.Changed, chunk.ID)
+				dirty = append(dirty, chunk)
+			}
+		}
+		// 已变更或已消失的旧 Chunk 需在覆盖写入前取出，用于撤销旧的符号链接
+		var staleIDs []string
+		for id, prevHash := range prevHashes {
+			if newHashes[id] != prevHash || prevHash == "" {
+				staleIDs = append(staleIDs, id)
+			}
+		}
+		prevChunks := gc.loadChunks(staleIDs)
+
+		// 5. 存储与索引 (Store & Index)，只重写内容有变化的 Chunk
+		for _, chunk := range dirty {
 			chunk.UpdatedAt = time.Now().Unix()
 
 			// A. 存储 Chunk 内容 (Hash)
@@ -125,13 +189,70 @@ func RunIncrementalIndexing(projectRoot string) error {
 					fmt.Printf("⚠️ Index Error: %v\n", err)
 				}
 			}
+
+			// C. 建立反向引用 (Set: 被引用 Symbol -> 引用方 ChunkIDs)，用于查询调用方
+			for _, symbol := range chunk.SymbolsReferenced {
+				if err := storage.Indexer.AddReferenceLink(symbol, chunk.ID); err != nil {
+					fmt.Printf("⚠️ Index Error: %v\n", err)
+				}
+			}
+
+			// D. 建立实现关系 (Set: 接口 Symbol -> 实现方 ChunkIDs)
+			for _, symbol := range chunk.Implements {
+				if err := storage.Indexer.AddImplementsLink(symbol, chunk.ID); err != nil {
+					fmt.Printf("⚠️ Index Error: %v\n", err)
+				}
+			}
+
+			// E. 词法索引 (BM25 词频)
+			doc := search.NewDocument(chunk.ID, lexicalText(chunk))
+			if _, err := storage.ChunkTermsKey.HSet(chunk.ID, &models.ChunkTerms{Terms: doc.Terms, Length: doc.Length}); err != nil {
+				fmt.Printf("❌ DB Error: %v\n", err)
+			}
 		}
 
-		// 5. 更新元数据 (标记该文件已处理)
-		storage.FileMetaKey.HSet(path, info.ModTime().Unix())
+		// 语义向量: 只为哈希变化 (或上次计算失败) 的 Chunk 重新计算
+		embedder.refresh(chunks)
 
-		return nil
-	})
+		// 6. 清理该文件中已删除/重命名的 Chunk
+		report.Removed = append(report.Removed, gc.removeStale(prevChunks, chunks)...)
+
+		// 7. 更新元数据 (标记该文件已处理)
+		storage.FileMetaKey.HSet(path, &models.FileMeta{
+			ContentHash: fileHashes[path],
+			ChunkHashes: newHashes,
+			Schema:      indexSchemaVersion,
+			IndexedAt:   time.Now().Unix(),
+		})
+		report.FilesIndexed++
+	}
+
+	// 8. 清理 root 下已被删除的文件
+	report.Removed = append(report.Removed, gc.pruneDeletedFiles(projectRoot)...)
+	return report, nil
+}
+
+// lexicalText 词法索引的输入: ChunkID、骨架、注释与定义/引用的标识符
+func lexicalText(chunk *models.Chunk) string {
+	return strings.Join([]string{
+		chunk.ID,
+		chunk.Skeleton,
+		search.ExtractComments(chunk.Body),
+		strings.Join(chunk.SymbolsDefined, " "),
+		strings.Join(chunk.SymbolsReferenced, " "),
+	}, "\n")
+}
+
+// indexSchemaVersion 索引结构版本；Chunk 字段或 Redis 索引结构变化时递增，
+// 已索引的文件即使内容未变也会整体重建 (例如补齐反向引用索引)
+const indexSchemaVersion = 4
+
+// chunkContentHash 对 Chunk 内容 (不含 UpdatedAt 与哈希字段本身) 计算哈希，带上索引结构版本
+func chunkContentHash(chunk *models.Chunk) string {
+	tmp := *chunk
+	tmp.UpdatedAt, tmp.ContentHash = 0, ""
+	hash, _ := utils.GetCanonicalHash(tmp)
+	return strconv.Itoa(indexSchemaVersion) + "-" + strconv.FormatUint(hash, 16)
 }
 
 // ParseGoFile 解析单个 Go 文件并返回 Chunks
@@ -140,88 +261,232 @@ func ParseGoFile(path string) ([]*models.Chunk, error) {
 	if err != nil {
 		return nil, err
 	}
+	return parseGoSource(path, content)
+}
 
+// parseGoSource 以 go/parser 解析给定内容 (无类型信息)
+func parseGoSource(path string, content []byte) ([]*models.Chunk, error) {
 	fset := token.NewFileSet()
 	node, err := parser.ParseFile(fset, path, content, parser.ParseComments)
 	if err != nil {
 		return nil, err
 	}
 
-	var chunks []*models.Chunk
+	return extractGoChunks(node, fset, path, content, nil), nil
+}
+
+// goDeclSpan 一个顶级声明对应的 Chunk 定位信息
+// 索引 (extractGoChunks) 与编辑定位 (LocateGoChunks) 共用同一份枚举，保证 ID 规则一致
+type goDeclSpan struct {
+	ID    string
+	Name  string // 不含包名的短符号: "Save" / "User.Save" / "User"
+	Decl  ast.Decl
+	Spec  ast.Spec // 仅 GenDecl 有效
+	Start int
+	End   int
+	// Grouped: spec 位于 type/var/const ( ... ) 分组内，区间只覆盖该 spec 本身 (不含关键字)
+	Grouped bool
+}
+
+// goDeclSpans 按声明顺序枚举文件中的 Chunk，并按 models.ChunkID 规则分配 ID
+// 第一个为文件头 (开头注释、package 子句与全部 import)；分组声明中的每个 spec 单独成块
+func goDeclSpans(node *ast.File, fset *token.FileSet, path string) []goDeclSpan {
+	alloc := models.NewChunkIDAllocator(path)
+	pkg := node.Name.Name
+
+	header := goDeclSpan{
+		ID:    alloc.Next(models.HeaderSymbol),
+		Name:  models.HeaderSymbol,
+		Start: 0,
+		End:   fset.Position(node.Name.End()).Offset,
+	}
+	for _, decl := range node.Decls {
+		if d, ok := decl.(*ast.GenDecl); ok && d.Tok == token.IMPORT {
+			header.End = fset.Position(d.End()).Offset
+		}
+	}
+	spans := []goDeclSpan{header}
 
-	// 遍历 AST 顶级声明
 	for _, decl := range node.Decls {
 		switch d := decl.(type) {
 		case *ast.FuncDecl:
-			// 提取函数或方法
-			chunks = append(chunks, extractGoFunc(d, fset, path, content))
+			name := goFuncName(d)
+			spans = append(spans, goDeclSpan{
+				ID:    alloc.Next(pkg + "." + name),
+				Name:  name,
+				Decl:  d,
+				Start: fset.Position(d.Pos()).Offset,
+				End:   fset.Position(d.End()).Offset,
+			})
 		case *ast.GenDecl:
-			// 提取类型定义 (struct, interface)
+			if d.Tok == token.IMPORT {
+				continue
+			}
+			grouped := d.Lparen.IsValid()
 			for _, spec := range d.Specs {
-				if typeSpec, ok := spec.(*ast.TypeSpec); ok {
-					chunks = append(chunks, extractGoType(d, typeSpec, fset, path, content))
+				name := goSpecName(spec)
+				span := goDeclSpan{
+					ID:      alloc.Next(pkg + "." + name),
+					Name:    name,
+					Decl:    d,
+					Spec:    spec,
+					Start:   fset.Position(d.Pos()).Offset,
+					End:     fset.Position(d.End()).Offset,
+					Grouped: grouped,
+				}
+				if grouped {
+					// 分组内的 spec: 区间从 spec 自身的文档注释开始
+					start := spec.Pos()
+					if doc := goSpecDoc(spec); doc != nil {
+						start = doc.Pos()
+					}
+					span.Start = fset.Position(start).Offset
+					span.End = fset.Position(spec.End()).Offset
 				}
+				spans = append(spans, span)
 			}
 		}
 	}
+	return spans
+}
 
-	return chunks, nil
+// goSpecName 类型取类型名；var/const 取第一个名字 (多名 spec 的其余名字登记在 SymbolsDefined)
+func goSpecName(spec ast.Spec) string {
+	switch x := spec.(type) {
+	case *ast.TypeSpec:
+		return x.Name.Name
+	case *ast.ValueSpec:
+		if len(x.Names) > 0 {
+			return x.Names[0].Name
+		}
+	}
+	return "_"
 }
 
-// extractGoFunc 提取函数/方法 Chunk
-func extractGoFunc(fn *ast.FuncDecl, fset *token.FileSet, path string, content []byte) *models.Chunk {
-	name := fn.Name.Name
-	chunkType := models.ChunkTypeFunction // 默认为 Function
+func goSpecDoc(spec ast.Spec) *ast.CommentGroup {
+	switch x := spec.(type) {
+	case *ast.TypeSpec:
+		return x.Doc
+	case *ast.ValueSpec:
+		return x.Doc
+	}
+	return nil
+}
 
-	// 处理 Receiver (方法): User.Save
+// goFuncName 函数返回 "Name"，方法返回 "Recv.Name"
+func goFuncName(fn *ast.FuncDecl) string {
 	if fn.Recv != nil && len(fn.Recv.List) > 0 {
-		chunkType = models.ChunkTypeMethod // 标记为 Method
+		if recvType := goReceiverTypeName(fn.Recv.List[0].Type); recvType != "" {
+			return recvType + "." + fn.Name.Name
+		}
+	}
+	return fn.Name.Name
+}
 
-		recvType := ""
-		expr := fn.Recv.List[0].Type
-		// 处理指针 *User 和普通 User
-		if star, ok := expr.(*ast.StarExpr); ok {
-			if ident, ok := star.X.(*ast.Ident); ok {
-				recvType = ident.Name
+// goReceiverTypeName 剥离指针、括号与类型参数: User, *User, Tool[v], *Cache[K, V] -> 基础类型名
+func goReceiverTypeName(expr ast.Expr) string {
+	for {
+		switch x := expr.(type) {
+		case *ast.StarExpr:
+			expr = x.X
+		case *ast.ParenExpr:
+			expr = x.X
+		case *ast.IndexExpr:
+			expr = x.X
+		case *ast.IndexListExpr:
+			expr = x.X
+		case *ast.Ident:
+			return x.Name
+		default:
+			return ""
+		}
+	}
+}
+
+// extractGoChunks 遍历 AST 顶级声明，生成 Chunks
+// typed 为 nil 时记录短名符号，否则记录类型检查得到的全限定符号
+func extractGoChunks(node *ast.File, fset *token.FileSet, path string, content []byte, typed *goTypedInfo) []*models.Chunk {
+	var chunks []*models.Chunk
+	imports := newGoImportTable(node)
+
+	for _, span := range goDeclSpans(node, fset, path) {
+		if span.Name == models.HeaderSymbol {
+			chunks = append(chunks, extractGoHeader(node, span, path, content, imports))
+			continue
+		}
+
+		var chunk *models.Chunk
+		switch d := span.Decl.(type) {
+		case *ast.FuncDecl:
+			// 提取函数或方法
+			chunk = extractGoFunc(d, span, fset, path, content, typed)
+			chunk.Imports = imports.used(d, typed)
+		case *ast.GenDecl:
+			switch spec := span.Spec.(type) {
+			case *ast.TypeSpec:
+				// 提取类型定义 (struct, interface)
+				chunk = extractGoType(spec, span, path, content, typed)
+			case *ast.ValueSpec:
+				// 提取包级变量/常量
+				chunk = extractGoValue(d.Tok, spec, span, path, content, typed)
+			}
+			if chunk != nil {
+				chunk.Imports = imports.used(span.Spec, typed)
 			}
-		} else if ident, ok := expr.(*ast.Ident); ok {
-			recvType = ident.Name
 		}
-		if recvType != "" {
-			name = recvType + "." + name
+		if chunk != nil {
+			chunks = append(chunks, chunk)
 		}
 	}
 
-	// 构造唯一 ID: filepath:FunctionName
-	id := fmt.Sprintf("%s:%s", path, name)
+	return chunks
+}
+
+// extractGoHeader 提取文件头 Chunk: 骨架为 package 子句，全文含开头注释与 import 块
+func extractGoHeader(node *ast.File, span goDeclSpan, path string, content []byte, imports *goImportTable) *models.Chunk {
+	return &models.Chunk{
+		ID:       span.ID,
+		Type:     models.ChunkTypeHeader,
+		Skeleton: "package " + node.Name.Name,
+		Body:     string(content[span.Start:span.End]),
+		Imports:  imports.all,
+		FilePath: path,
+	}
+}
+
+// extractGoFunc 提取函数/方法 Chunk
+func extractGoFunc(fn *ast.FuncDecl, span goDeclSpan, fset *token.FileSet, path string, content []byte, typed *goTypedInfo) *models.Chunk {
+	chunkType := models.ChunkTypeFunction // 默认为 Function
+	if fn.Recv != nil && len(fn.Recv.List) > 0 {
+		chunkType = models.ChunkTypeMethod // 标记为 Method
+	}
 
 	// 提取完整代码 (Body)
-	start := fset.Position(fn.Pos()).Offset
-	end := fset.Position(fn.End()).Offset
-	fullBody := string(content[start:end])
+	fullBody := string(content[span.Start:span.End])
 
 	// 生成骨架 (Skeleton)
 	skeleton := generateGoSkeleton(fn, fset)
 
-	return &models.Chunk{
-		ID:                id,
+	chunk := &models.Chunk{
+		ID:                span.ID,
 		Type:              chunkType,
 		Skeleton:          skeleton,
 		Body:              fullBody,
-		SymbolsDefined:    []string{name},            // 定义了自己
+		SymbolsDefined:    []string{span.Name},       // 定义了自己
 		SymbolsReferenced: extractGoSymbols(fn.Body), // 引用了别人
 		FilePath:          path,
 	}
+	if typed != nil {
+		// 类型检查模式: 签名中的类型同样计入引用
+		chunk.SymbolsDefined = append(chunk.SymbolsDefined, typed.defined(fn.Name)...)
+		chunk.SymbolsReferenced = typed.references(fn)
+	}
+	return chunk
 }
 
 // extractGoType 提取结构体/接口 Chunk
-func extractGoType(decl *ast.GenDecl, spec *ast.TypeSpec, fset *token.FileSet, path string, content []byte) *models.Chunk {
-	name := spec.Name.Name
-	id := fmt.Sprintf("%s:%s", path, name)
-
-	start := fset.Position(decl.Pos()).Offset
-	end := fset.Position(decl.End()).Offset
-	fullBody := string(content[start:end])
+func extractGoType(spec *ast.TypeSpec, span goDeclSpan, path string, content []byte, typed *goTypedInfo) *models.Chunk {
+	fullBody := string(content[span.Start:span.End])
 
 	// 细分 Type 为 Struct 或 Interface
 	chunkType := models.ChunkTypeType // 默认兜底
@@ -232,15 +497,53 @@ func extractGoType(decl *ast.GenDecl, spec *ast.TypeSpec, fset *token.FileSet, p
 		chunkType = models.ChunkTypeInterface
 	}
 
-	return &models.Chunk{
-		ID:                id,
+	chunk := &models.Chunk{
+		ID:                span.ID,
 		Type:              chunkType,
 		Skeleton:          fullBody, // 对于 Type，骨架即全文
 		Body:              fullBody,
-		SymbolsDefined:    []string{name},
+		SymbolsDefined:    []string{span.Name},
 		SymbolsReferenced: extractGoSymbols(spec.Type), // 扫描字段类型依赖
 		FilePath:          path,
 	}
+	if typed != nil {
+		chunk.SymbolsDefined = append(chunk.SymbolsDefined, typed.defined(spec.Name)...)
+		chunk.SymbolsReferenced = typed.references(spec.Type)
+		chunk.Implements = typed.implementsOf(spec.Name)
+	}
+	return chunk
+}
+
+// extractGoValue 提取包级 var/const Chunk (如 redisdb.NewHashKey、llm.NewModel 的注册表)
+func extractGoValue(tok token.Token, spec *ast.ValueSpec, span goDeclSpan, path string, content []byte, typed *goTypedInfo) *models.Chunk {
+	fullBody := string(content[span.Start:span.End])
+
+	chunkType := models.ChunkTypeVar
+	if tok == token.CONST {
+		chunkType = models.ChunkTypeConst
+	}
+
+	chunk := &models.Chunk{
+		ID:                span.ID,
+		Type:              chunkType,
+		Skeleton:          fullBody, // 与 Type 相同，骨架即全文
+		Body:              fullBody,
+		SymbolsReferenced: extractGoSymbols(spec), // 扫描初始化表达式与类型依赖
+		FilePath:          path,
+	}
+	for _, ident := range spec.Names {
+		if ident.Name == "_" {
+			continue
+		}
+		chunk.SymbolsDefined = append(chunk.SymbolsDefined, ident.Name)
+		if typed != nil {
+			chunk.SymbolsDefined = append(chunk.SymbolsDefined, typed.defined(ident)...)
+		}
+	}
+	if typed != nil {
+		chunk.SymbolsReferenced = typed.references(spec)
+	}
+	return chunk
 }
 
 // generateGoSkeleton 生成骨架: 把函数体掏空，换成 "..."
@@ -304,5 +607,7 @@ func extractGoSymbols(node ast.Node) []string {
 			list = append(list, k)
 		}
 	}
+	// 排序保证输出稳定，否则 Chunk 内容哈希每次都会变化
+	sort.Strings(list)
 	return list
 }
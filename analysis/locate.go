@@ -0,0 +1,50 @@
+package analysis
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+)
+
+// ChunkSpan 一个 Chunk 在源文件中的字节区间 [Start, End)
+type ChunkSpan struct {
+	ID    string
+	Start int
+	End   int
+	// GroupKeyword: 位于 type/var/const ( ... ) 分组内的 spec 对应的关键字，
+	// 区间不含关键字，替换时需剥离新内容开头的同名关键字
+	GroupKeyword string
+}
+
+// LocateGoChunks 解析 Go 源码，返回每个 Chunk 的 ID 与字节区间
+// 与索引使用同一套 ID 规则，供 editing 实时定位修改目标
+func LocateGoChunks(path string, content []byte) ([]ChunkSpan, error) {
+	fset := token.NewFileSet()
+	node, err := parser.ParseFile(fset, path, content, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+
+	var spans []ChunkSpan
+	for _, span := range goDeclSpans(node, fset, path) {
+		cs := ChunkSpan{ID: span.ID, Start: span.Start, End: span.End}
+		if span.Grouped {
+			cs.GroupKeyword = span.Decl.(*ast.GenDecl).Tok.String()
+		}
+		spans = append(spans, cs)
+	}
+	return spans, nil
+}
+
+// LocateChunks 按扩展名分派到对应语言的定位实现
+func LocateChunks(path string, content []byte) ([]ChunkSpan, error) {
+	switch filepath.Ext(path) {
+	case ".go":
+		return LocateGoChunks(path, content)
+	case ".ts", ".tsx":
+		return LocateTSChunks(path, content)
+	}
+	return nil, fmt.Errorf("unsupported file type for chunk locating: %s", path)
+}
@@ -0,0 +1,185 @@
+package analysis
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"sysevov2/config"
+	"sysevov2/models"
+
+	"github.com/samber/lo"
+)
+
+// Parser 单一语言的源码解析器，将文件内容切分为 Chunks
+// 实现须是可比较类型 (通常为指针)，同一实例可注册到多个扩展名
+type Parser interface {
+	Parse(path string, content []byte) ([]*models.Chunk, error)
+}
+
+// preparer 可选扩展：在逐文件 Parse 之前拿到本轮 root 下所有待索引文件，
+// 用于整包加载等需要跨文件上下文的解析器 (如类型检查模式的 Go)
+type preparer interface {
+	Prepare(root string, files []string) error
+}
+
+// finisher 可选扩展：root 本轮解析结束后释放 Prepare 缓存的结果
+type finisher interface {
+	Finish(root string)
+}
+
+var (
+	parsersMutex sync.RWMutex
+	// parsers: 小写扩展名 (含点, 如 ".go") -> Parser
+	parsers = make(map[string]Parser)
+)
+
+// RegisterParser 为扩展名注册解析器，已存在时覆盖；p 为 nil 时注销
+func RegisterParser(ext string, p Parser) {
+	ext = normalizeExt(ext)
+	parsersMutex.Lock()
+	defer parsersMutex.Unlock()
+	if p == nil {
+		delete(parsers, ext)
+		return
+	}
+	parsers[ext] = p
+}
+
+// parserFor 返回文件对应的解析器；未注册或未在配置中启用时返回 false
+func parserFor(path string) (Parser, bool) {
+	ext := normalizeExt(filepath.Ext(path))
+	if !parserEnabled(ext) {
+		return nil, false
+	}
+	parsersMutex.RLock()
+	defer parsersMutex.RUnlock()
+	p, ok := parsers[ext]
+	return p, ok
+}
+
+// parserEnabled 检查 config.Indexer.Parsers 白名单，为空表示启用全部已注册解析器
+func parserEnabled(ext string) bool {
+	if len(config.Indexer.Parsers) == 0 {
+		return true
+	}
+	for _, enabled := range config.Indexer.Parsers {
+		if normalizeExt(enabled) == ext {
+			return true
+		}
+	}
+	return false
+}
+
+func normalizeExt(ext string) string {
+	ext = strings.ToLower(strings.TrimSpace(ext))
+	if ext != "" && !strings.HasPrefix(ext, ".") {
+		ext = "." + ext
+	}
+	return ext
+}
+
+// prepareParsers 按解析器分组本轮变动文件，调用实现了 preparer 的解析器
+func prepareParsers(root string, files []string) {
+	grouped := make(map[Parser][]string)
+	var order []Parser
+	for _, path := range files {
+		p, ok := parserFor(path)
+		if !ok {
+			continue
+		}
+		if _, seen := grouped[p]; !seen {
+			order = append(order, p)
+		}
+		grouped[p] = append(grouped[p], path)
+	}
+
+	for _, p := range order {
+		if pp, ok := p.(preparer); ok {
+			if err := pp.Prepare(root, grouped[p]); err != nil {
+				fmt.Printf("⚠️ Parser prepare failed for %s: %v\n", root, err)
+			}
+		}
+	}
+}
+
+// finishParsers 通知实现了 finisher 的已注册解析器 root 本轮解析结束
+func finishParsers(root string) {
+	parsersMutex.RLock()
+	list := lo.Uniq(lo.Values(parsers))
+	parsersMutex.RUnlock()
+	for _, p := range list {
+		if f, ok := p.(finisher); ok {
+			f.Finish(root)
+		}
+	}
+}
+
+// goParser Go 解析器：类型检查模式下由 Prepare 整包加载，Parse 时优先取用加载结果
+type goParser struct {
+	mutex sync.Mutex
+	// typed: root -> 文件路径 (与 Walk 产出一致) -> 类型检查模式产出的 Chunks，取用后即删除
+	// 每次 Prepare 先丢弃该 root 上一轮的结果，本轮结束后由 Finish 清空未取用的部分
+	typed map[string]map[string][]*models.Chunk
+}
+
+func (p *goParser) Prepare(root string, files []string) error {
+	p.mutex.Lock()
+	delete(p.typed, root)
+	p.mutex.Unlock()
+	if !config.Indexer.TypedGo || len(files) == 0 {
+		return nil
+	}
+	typed, err := LoadTypedGoChunks(root)
+	if err != nil {
+		return fmt.Errorf("typed Go loading failed, falling back to go/parser: %w", err)
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.typed[root] = typed
+	return nil
+}
+
+func (p *goParser) Parse(path string, content []byte) ([]*models.Chunk, error) {
+	path = filepath.Clean(path)
+	p.mutex.Lock()
+	var chunks []*models.Chunk
+	ok := false
+	for _, typed := range p.typed {
+		if chunks, ok = typed[path]; ok {
+			delete(typed, path)
+			break
+		}
+	}
+	p.mutex.Unlock()
+	if ok {
+		return chunks, nil
+	}
+	// 不在任何已加载包中 (build tag 排除、嵌套 module 等) 时逐文件解析
+	return parseGoSource(path, content)
+}
+
+// Finish 丢弃 root 本轮未被取用的加载结果 (未变动文件的 Chunks)，避免跨轮残留与内存增长
+func (p *goParser) Finish(root string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	delete(p.typed, root)
+}
+
+// tsParser TS/TSX 解析器，委托给 Node sidecar
+type tsParser struct{}
+
+func (p *tsParser) Parse(path string, content []byte) ([]*models.Chunk, error) {
+	if content == nil {
+		content = []byte{}
+	}
+	return ParseTSSource(path, content)
+}
+
+func init() {
+	RegisterParser(".go", &goParser{typed: make(map[string]map[string][]*models.Chunk)})
+	ts := &tsParser{}
+	RegisterParser(".ts", ts)
+	RegisterParser(".tsx", ts)
+}
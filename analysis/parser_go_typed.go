@@ -0,0 +1,229 @@
+package analysis
+
+import (
+	"fmt"
+	"go/ast"
+	"go/types"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"sysevov2/models"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// goTypedInfo 类型检查模式下的符号解析上下文
+type goTypedInfo struct {
+	info *types.Info
+	// localPkgs: root 下加载到的包路径，只有这些包内的对象才计入引用
+	localPkgs map[string]bool
+	// implements: 本地具名类型 -> 其满足的本地接口 (全限定名)，所有包共享
+	implements map[*types.TypeName][]string
+}
+
+// LoadTypedGoChunks 使用 go/packages 整包加载 root 下的 Go 代码 (含完整类型信息)
+// 返回: 文件路径 -> 该文件的 Chunks；路径与 filepath.Walk(root) 产出的一致 (root 拼接相对路径)，
+// 保证与逐文件解析模式得到相同的 ChunkID 与 FilePath
+// 与 ParseGoFile 不同，这里的 SymbolsReferenced 是全限定名，
+// 例如 "sysevov2/storage.DirtyIndexClient.AddSymbolLink"，不同包的同名符号不再互相冲突
+func LoadTypedGoChunks(root string) (map[string][]*models.Chunk, error) {
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &packages.Config{
+		Mode: packages.NeedName | packages.NeedFiles | packages.NeedSyntax |
+			packages.NeedTypes | packages.NeedTypesInfo,
+		Dir: absRoot,
+	}
+	pkgs, err := packages.Load(cfg, "./...")
+	if err != nil {
+		return nil, err
+	}
+	if len(pkgs) == 0 {
+		return nil, fmt.Errorf("no Go packages found under %s", absRoot)
+	}
+
+	localPkgs := make(map[string]bool)
+	for _, pkg := range pkgs {
+		localPkgs[pkg.PkgPath] = true
+	}
+	implements := computeImplements(pkgs)
+
+	result := make(map[string][]*models.Chunk)
+	for _, pkg := range pkgs {
+		// 类型错误不致命：go/types 仍会尽量填充 TypesInfo
+		for _, e := range pkg.Errors {
+			fmt.Printf("⚠️ Package %s: %v\n", pkg.PkgPath, e)
+		}
+		if pkg.TypesInfo == nil {
+			continue
+		}
+		typed := &goTypedInfo{info: pkg.TypesInfo, localPkgs: localPkgs, implements: implements}
+
+		for _, file := range pkg.Syntax {
+			absPath := pkg.Fset.File(file.Pos()).Name()
+			// 跳过 cgo 生成文件等不在 root 下的源文件
+			rel, err := filepath.Rel(absRoot, absPath)
+			if err != nil || !strings.HasSuffix(absPath, ".go") || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+				continue
+			}
+			content, err := os.ReadFile(absPath)
+			if err != nil {
+				continue
+			}
+			path := filepath.Join(root, rel)
+			result[path] = extractGoChunks(file, pkg.Fset, path, content, typed)
+		}
+	}
+	return result, nil
+}
+
+// defined 返回标识符定义的全限定符号
+func (t *goTypedInfo) defined(ident *ast.Ident) []string {
+	obj := t.info.Defs[ident]
+	if obj == nil || obj.Pkg() == nil {
+		return nil
+	}
+	return []string{qualifiedGoName(obj)}
+}
+
+// references 提取节点内引用的本地全限定符号 (函数、方法、类型、包级变量/常量)
+func (t *goTypedInfo) references(node ast.Node) []string {
+	refs := make(map[string]struct{})
+	if node == nil {
+		return nil
+	}
+
+	ast.Inspect(node, func(n ast.Node) bool {
+		switch x := n.(type) {
+		case *ast.SelectorExpr:
+			// 字段访问: user.Name -> 记录字段所属的具名类型
+			if sel, ok := t.info.Selections[x]; ok && sel.Kind() == types.FieldVal {
+				if named := namedTypeOf(sel.Recv()); named != nil && t.isLocal(named.Obj()) {
+					refs[qualifiedGoName(named.Obj())] = struct{}{}
+				}
+			}
+		case *ast.Ident:
+			obj := t.info.Uses[x]
+			if obj == nil || !t.isLocal(obj) {
+				return true
+			}
+			switch o := obj.(type) {
+			case *types.Func, *types.TypeName:
+				refs[qualifiedGoName(o)] = struct{}{}
+			case *types.Var, *types.Const:
+				// 只记录包级变量/常量，局部变量与字段不构成跨 Chunk 依赖
+				if o.Parent() == o.Pkg().Scope() {
+					refs[qualifiedGoName(o)] = struct{}{}
+				}
+			}
+		}
+		return true
+	})
+
+	list := make([]string, 0, len(refs))
+	for k := range refs {
+		list = append(list, k)
+	}
+	sort.Strings(list)
+	return list
+}
+
+// implementsOf 返回类型声明满足的本地接口
+func (t *goTypedInfo) implementsOf(ident *ast.Ident) []string {
+	if tn, ok := t.info.Defs[ident].(*types.TypeName); ok {
+		return t.implements[tn]
+	}
+	return nil
+}
+
+// computeImplements 计算 root 下所有具名类型 (T 或 *T) 满足的非空接口，接口之间的嵌入关系同样记录
+func computeImplements(pkgs []*packages.Package) map[*types.TypeName][]string {
+	var ifaces, named []*types.TypeName
+	for _, pkg := range pkgs {
+		if pkg.Types == nil {
+			continue
+		}
+		scope := pkg.Types.Scope()
+		for _, name := range scope.Names() {
+			tn, ok := scope.Lookup(name).(*types.TypeName)
+			if !ok || tn.IsAlias() {
+				continue
+			}
+			named = append(named, tn)
+			if iface, ok := tn.Type().Underlying().(*types.Interface); ok && iface.NumMethods() > 0 {
+				ifaces = append(ifaces, tn)
+			}
+		}
+	}
+
+	result := make(map[*types.TypeName][]string)
+	for _, tn := range named {
+		typ := instantiateForCheck(tn.Type())
+		for _, iface := range ifaces {
+			if iface == tn {
+				continue
+			}
+			it := iface.Type().Underlying().(*types.Interface)
+			if types.Implements(typ, it) || (!types.IsInterface(typ) && types.Implements(types.NewPointer(typ), it)) {
+				result[tn] = append(result[tn], qualifiedGoName(iface))
+			}
+		}
+	}
+	return result
+}
+
+// instantiateForCheck 泛型类型 (如 Tool[v]) 未实例化时 types.Implements 行为未定义，
+// 以各类型参数的约束作为实参实例化后再判断
+func instantiateForCheck(t types.Type) types.Type {
+	named, ok := t.(*types.Named)
+	if !ok || named.TypeParams().Len() == 0 {
+		return t
+	}
+	args := make([]types.Type, named.TypeParams().Len())
+	for i := range args {
+		args[i] = named.TypeParams().At(i).Constraint()
+	}
+	inst, err := types.Instantiate(nil, named, args, false)
+	if err != nil {
+		return t
+	}
+	return inst
+}
+
+func (t *goTypedInfo) isLocal(obj types.Object) bool {
+	return obj.Pkg() != nil && t.localPkgs[obj.Pkg().Path()]
+}
+
+// qualifiedGoName 生成全限定符号名
+// 函数/类型/变量: "pkgpath.Name"；方法: "pkgpath.Recv.Method"；
+// 接口方法没有独立的 Chunk，记录为接口类型本身 "pkgpath.Iface"
+func qualifiedGoName(obj types.Object) string {
+	if fn, ok := obj.(*types.Func); ok {
+		if sig, ok := fn.Type().(*types.Signature); ok && sig.Recv() != nil {
+			if named := namedTypeOf(sig.Recv().Type()); named != nil && named.Obj().Pkg() != nil {
+				prefix := named.Obj().Pkg().Path() + "." + named.Obj().Name()
+				if types.IsInterface(named) {
+					return prefix
+				}
+				return prefix + "." + fn.Name()
+			}
+		}
+	}
+	return obj.Pkg().Path() + "." + obj.Name()
+}
+
+// namedTypeOf 剥离指针与泛型实例化，返回原始具名类型
+func namedTypeOf(t types.Type) *types.Named {
+	if ptr, ok := t.(*types.Pointer); ok {
+		t = ptr.Elem()
+	}
+	if named, ok := types.Unalias(t).(*types.Named); ok {
+		return named.Origin()
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package analysis
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"sysevov2/config"
+	"sysevov2/models"
+	"sysevov2/storage"
+
+	"github.com/doptime/config/cfgredis"
+	"github.com/samber/lo"
+)
+
+// fakeParser 每个非空行生成一个函数 Chunk，行内容即符号名
+type fakeParser struct {
+	parsed []string
+}
+
+func (p *fakeParser) Parse(path string, content []byte) ([]*models.Chunk, error) {
+	p.parsed = append(p.parsed, path)
+	alloc := models.NewChunkIDAllocator(path)
+	var chunks []*models.Chunk
+	for _, line := range strings.Split(string(content), "\n") {
+		name := strings.TrimSpace(line)
+		if name == "" {
+			continue
+		}
+		chunks = append(chunks, &models.Chunk{
+			ID:             alloc.Next("fake." + name),
+			Type:           models.ChunkTypeFunction,
+			Skeleton:       "func " + name + "()",
+			Body:           "func " + name + "() {}",
+			SymbolsDefined: []string{name},
+			FilePath:       path,
+		})
+	}
+	return chunks, nil
+}
+
+// withParsersWhitelist 测试期间替换 config.Indexer.Parsers
+func withParsersWhitelist(t *testing.T, enabled ...string) {
+	saved := config.Indexer.Parsers
+	config.Indexer.Parsers = enabled
+	t.Cleanup(func() { config.Indexer.Parsers = saved })
+}
+
+func TestRegisterParser(t *testing.T) {
+	withParsersWhitelist(t)
+	fake := &fakeParser{}
+	RegisterParser("FAKE", fake)
+	defer RegisterParser(".fake", nil)
+
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"a/b.fake", true},
+		{"a/B.FAKE", true},
+		{"a/b.fake.txt", false},
+		{"a/fake", false},
+	}
+	for _, tt := range tests {
+		p, ok := parserFor(tt.path)
+		if ok != tt.want || (ok && p != fake) {
+			t.Errorf("parserFor(%q) = %v, %v; want fake parser: %v", tt.path, p, ok, tt.want)
+		}
+	}
+
+	// 白名单未包含时不启用
+	withParsersWhitelist(t, ".go")
+	if _, ok := parserFor("a/b.fake"); ok {
+		t.Errorf("parserFor ignored the Indexer.Parsers whitelist")
+	}
+	withParsersWhitelist(t, "fake")
+	if _, ok := parserFor("a/b.fake"); !ok {
+		t.Errorf("parserFor rejected a whitelisted extension")
+	}
+
+	RegisterParser(".fake", nil)
+	if _, ok := parserFor("a/b.fake"); ok {
+		t.Errorf("parser still registered after RegisterParser(ext, nil)")
+	}
+}
+
+// TestIndexingWithFakeParser 写入 "default" Redis 中的索引 Key (sysevo/chunks、sysevo/files/index、sys/idx/*)，
+// 只在显式设置 SYSEVO_REDIS_TESTS=1 时运行，应指向一个可丢弃的测试库
+func TestIndexingWithFakeParser(t *testing.T) {
+	if os.Getenv("SYSEVO_REDIS_TESTS") != "1" {
+		t.Skip("set SYSEVO_REDIS_TESTS=1 to run against a disposable \"default\" Redis")
+	}
+	if _, ok := cfgredis.Servers.Get("default"); !ok {
+		t.Skip("redis not configured")
+	}
+	withParsersWhitelist(t, ".fake")
+	defer func(embeddings bool) { config.Indexer.Embeddings = embeddings }(config.Indexer.Embeddings)
+	config.Indexer.Embeddings = false
+
+	fake := &fakeParser{}
+	RegisterParser(".fake", fake)
+	defer RegisterParser(".fake", nil)
+
+	root := t.TempDir()
+	path := filepath.Join(root, "lib.fake")
+	if err := os.WriteFile(path, []byte("Hello\nWorld\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// 同目录下未注册扩展名的文件不应交给任何解析器
+	if err := os.WriteFile(filepath.Join(root, "notes.txt"), []byte("Ignored\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	wantIDs := []string{
+		models.BuildChunkID(path, "fake.Hello"),
+		models.BuildChunkID(path, "fake.World"),
+	}
+	defer func() {
+		storage.DeleteChunks(wantIDs...)
+		storage.DeleteFileRecords(path)
+	}()
+
+	report, err := RunIncrementalIndexing(root)
+	if err != nil {
+		t.Fatalf("RunIncrementalIndexing: %v", err)
+	}
+	if len(fake.parsed) != 1 || fake.parsed[0] != path {
+		t.Fatalf("fake parser called with %v, want [%s]", fake.parsed, path)
+	}
+	if report.FilesIndexed != 1 {
+		t.Errorf("FilesIndexed = %d, want 1", report.FilesIndexed)
+	}
+	for _, id := range wantIDs {
+		if !lo.Contains(report.Added, id) {
+			t.Errorf("report.Added = %v, missing %s", report.Added, id)
+		}
+		chunk, err := storage.ChunkStorage.HGet(id)
+		if err != nil || chunk == nil {
+			t.Errorf("chunk %s not stored: %v", id, err)
+			continue
+		}
+		if chunk.FilePath != path || chunk.ContentHash == "" {
+			t.Errorf("chunk %s stored as %+v", id, chunk)
+		}
+	}
+
+	// 内容未变时第二轮不再调用解析器
+	if _, err := RunIncrementalIndexing(root); err != nil {
+		t.Fatalf("RunIncrementalIndexing: %v", err)
+	}
+	if len(fake.parsed) != 1 {
+		t.Errorf("unchanged file parsed again: %v", fake.parsed)
+	}
+}
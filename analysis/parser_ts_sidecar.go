@@ -1,84 +1,77 @@
 package analysis
 
 import (
-	"bytes"
-	"encoding/json"
-	"fmt"
-	"os"
-	"os/exec"
-	"path/filepath"
+	"strings"
 	"sysevov2/models"
 )
 
-// analyzerScriptPath 定义分析器脚本的相对路径
-// 部署时确保 analyzers 目录和二进制文件在一起，或者通过环境变量配置
-const analyzerScriptPath = "../analysis/analyzer.js"
-
-// ParseTSFile 启动一个 Node 子进程来分析目标文件
+// ParseTSFile 交给常驻的 Node sidecar (见 ts_worker.go) 分析目标文件
 func ParseTSFile(targetPath string) ([]*models.Chunk, error) {
-	// 1. 获取当前工作目录，定位分析器脚本
-	cwd, _ := os.Getwd()
-	scriptAbsPath := filepath.Join(cwd, analyzerScriptPath)
-
-	// 检查脚本是否存在 (开发阶段常见错误)
-	if _, err := os.Stat(scriptAbsPath); os.IsNotExist(err) {
-		return nil, fmt.Errorf("TS analyzer not found at: %s", scriptAbsPath)
-	}
-
-	// 2. 构造命令: node <script> <target>
-	// 这完全符合你的要求：运行第三方可执行文件 (node)，不侵入目标项目
-	cmd := exec.Command("node", scriptAbsPath, targetPath)
-
-	// 3. 捕获输出
-	var out bytes.Buffer
-	var stderr bytes.Buffer
-	cmd.Stdout = &out
-	cmd.Stderr = &stderr
+	return ParseTSSource(targetPath, nil)
+}
 
-	// 4. 执行
-	err := cmd.Run()
+// ParseTSSource 分析给定内容 (content 为 nil 时读磁盘)；索引时传入已读取并计算过哈希的内容，
+// 保证 Chunks 与 FileMeta 中的内容哈希对应同一版本
+func ParseTSSource(targetPath string, content []byte) ([]*models.Chunk, error) {
+	rawChunks, err := currentTSPool().analyze(targetPath, content)
 	if err != nil {
-		return nil, fmt.Errorf("node exec failed: %v | stderr: %s", err, stderr.String())
+		return nil, err
 	}
 
-	// 5. 解析 JSON
-	var rawChunks []struct {
-		ID                string   `json:"id"`
-		Type              string   `json:"type"` // JSON 中的 Type 现在是字符串
-		Skeleton          string   `json:"skeleton"`
-		Body              string   `json:"body"`
-		SymbolsReferenced []string `json:"symbols_referenced"`
-	}
-
-	if err := json.Unmarshal(out.Bytes(), &rawChunks); err != nil {
-		// 如果输出不是 JSON，可能是脚本崩了打印了堆栈
-		return nil, fmt.Errorf("json parse failed: %v | output: %s", err, out.String())
-	}
-
-	// 6. 转换模型
+	// 转换模型 (ID 规则与 Go 一致，重载签名等重名声明追加序号)
+	alloc := models.NewChunkIDAllocator(targetPath)
 	var chunks []*models.Chunk
 	for _, rc := range rawChunks {
-		chunks = append(chunks, &models.Chunk{
-			ID:                rc.ID,
+		chunk := &models.Chunk{
+			ID:                alloc.Next(rc.Name),
 			Type:              rc.Type, // 直接赋值字符串
 			Skeleton:          rc.Skeleton,
 			Body:              rc.Body,
-			SymbolsDefined:    extractNameFromID(rc.ID), // 从 ID 反推名字
 			SymbolsReferenced: rc.SymbolsReferenced,
+			Imports:           rc.Imports,
+			Implements:        rc.Implements,
 			FilePath:          targetPath,
-		})
+		}
+		// 文件头不定义符号
+		if rc.Type != models.ChunkTypeHeader {
+			chunk.SymbolsDefined = tsDefinedSymbols(targetPath, rc.Name)
+		}
+		chunks = append(chunks, chunk)
 	}
 
 	return chunks, nil
 }
 
-// 辅助函数：从 ID "path/to/file.ts:FuncName" 中提取 "FuncName"
-func extractNameFromID(id string) []string {
-	// 假设 ID 是 "path:name"
-	for i := len(id) - 1; i >= 0; i-- {
-		if id[i] == ':' {
-			return []string{id[i+1:]}
-		}
+// LocateTSChunks 通过 sidecar 解析 TS 源码，返回每个 Chunk 的 ID 与字节区间
+// ID 分配顺序与 ParseTSFile 一致，供 editing 实时定位修改目标
+func LocateTSChunks(path string, content []byte) ([]ChunkSpan, error) {
+	rawChunks, err := currentTSPool().analyze(path, content)
+	if err != nil {
+		return nil, err
+	}
+
+	alloc := models.NewChunkIDAllocator(path)
+	spans := make([]ChunkSpan, 0, len(rawChunks))
+	for _, rc := range rawChunks {
+		spans = append(spans, ChunkSpan{ID: alloc.Next(rc.Name), Start: rc.Start, End: rc.End})
+	}
+	return spans, nil
+}
+
+// CheckTSSyntax 通过 sidecar 对 TS/JS 内容 (通常尚未落盘) 做语法检查，返回语法错误；空内容视为合法
+func CheckTSSyntax(path string, content []byte) ([]TSDiagnostic, error) {
+	if len(content) == 0 {
+		return nil, nil
+	}
+	return currentTSPool().checkSyntax(path, content)
+}
+
+// tsDefinedSymbols 登记 "path:Name" (import 解析后的精确引用)、"Name"；
+// 方法另外登记裸方法名 "method"，以便按 obj.method() 引用时仍可命中
+func tsDefinedSymbols(path, name string) []string {
+	symbols := []string{models.BuildChunkID(path, name), name}
+	if i := strings.LastIndex(name, "."); i > 0 {
+		symbols = append(symbols, name[i+1:])
 	}
-	return []string{"anonymous"}
+	return symbols
 }
@@ -0,0 +1,33 @@
+package analysis
+
+import (
+	"fmt"
+	"sync"
+)
+
+// IndexReport 一次索引运行的 Chunk 变更统计
+type IndexReport struct {
+	FilesIndexed int
+	Added        []string // 新增的 ChunkID
+	Changed      []string // 内容哈希变化、已重写的 ChunkID
+	Removed      []string // 已删除的 ChunkID
+	mutex        sync.Mutex
+}
+
+// Merge 合并另一个 root 的统计结果 (并发安全)
+func (r *IndexReport) Merge(other *IndexReport) {
+	if other == nil {
+		return
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.FilesIndexed += other.FilesIndexed
+	r.Added = append(r.Added, other.Added...)
+	r.Changed = append(r.Changed, other.Changed...)
+	r.Removed = append(r.Removed, other.Removed...)
+}
+
+func (r *IndexReport) String() string {
+	return fmt.Sprintf("%d files indexed, %d chunks added, %d changed, %d removed",
+		r.FilesIndexed, len(r.Added), len(r.Changed), len(r.Removed))
+}
@@ -0,0 +1,182 @@
+package analysis
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"sysevov2/models"
+	"sysevov2/storage"
+
+	"github.com/samber/lo"
+)
+
+// staleCollector 比对文件新旧 Chunk 集合，清理已消失的 Chunk 及其符号链接
+// 删除文件、删除/重命名函数后，旧 Chunk 不再残留在 sysevo/chunks 与 sys/idx/sym/* 中
+type staleCollector struct {
+	legacyOnce sync.Once
+	// legacy: FilePath -> ChunkIDs，兼容尚无 FileMeta 记录的旧索引数据
+	legacy map[string][]string
+}
+
+func newStaleCollector() *staleCollector {
+	return &staleCollector{}
+}
+
+// previousChunkHashes 返回文件上一次索引产出的 ChunkID -> ContentHash
+// 旧索引数据没有哈希记录，值为空字符串 (视为已变更)
+func (g *staleCollector) previousChunkHashes(path string) map[string]string {
+	if meta, err := storage.FileMetaKey.HGet(path); err == nil && meta != nil && meta.ChunkHashes != nil {
+		return meta.ChunkHashes
+	}
+	prev := make(map[string]string)
+	for _, id := range g.legacyChunkIDs(path) {
+		prev[id] = ""
+	}
+	return prev
+}
+
+// legacyChunkIDs 首次需要时全量扫描一次 ChunkStorage，按 FilePath 分组
+func (g *staleCollector) legacyChunkIDs(path string) []string {
+	g.legacyOnce.Do(func() {
+		g.legacy = make(map[string][]string)
+		all, err := storage.ChunkStorage.HGetAll()
+		if err != nil {
+			fmt.Printf("⚠️ Failed to load chunks for stale check: %v\n", err)
+			return
+		}
+		for id, chunk := range all {
+			if chunk != nil {
+				g.legacy[chunk.FilePath] = append(g.legacy[chunk.FilePath], id)
+			}
+		}
+	})
+	return g.legacy[path]
+}
+
+// loadChunks 读取旧 Chunk 实体 (实体已丢失时值为 nil)，须在覆盖写入之前调用
+func (g *staleCollector) loadChunks(ids []string) map[string]*models.Chunk {
+	chunks := make(map[string]*models.Chunk, len(ids))
+	for _, id := range ids {
+		chunk, err := storage.ChunkStorage.HGet(id)
+		if err != nil {
+			chunk = nil
+		}
+		chunks[id] = chunk
+	}
+	return chunks
+}
+
+// removeStale 删除 prev 中已不存在于 current 的 Chunk，
+// 并撤销 current 中仍存在但不再定义/引用/实现的符号链接；返回被删除的 ChunkID
+func (g *staleCollector) removeStale(prev map[string]*models.Chunk, current []*models.Chunk) []string {
+	currentByID := lo.KeyBy(current, func(c *models.Chunk) string { return c.ID })
+
+	var removed []string
+	for id, old := range prev {
+		cur, kept := currentByID[id]
+		if old != nil {
+			for _, symbol := range old.SymbolsDefined {
+				if kept && lo.Contains(cur.SymbolsDefined, symbol) {
+					continue
+				}
+				if err := storage.Indexer.RemoveSymbolLink(symbol, id); err != nil {
+					fmt.Printf("⚠️ Index Error: %v\n", err)
+				}
+			}
+			for _, symbol := range old.SymbolsReferenced {
+				if kept && lo.Contains(cur.SymbolsReferenced, symbol) {
+					continue
+				}
+				if err := storage.Indexer.RemoveReferenceLink(symbol, id); err != nil {
+					fmt.Printf("⚠️ Index Error: %v\n", err)
+				}
+			}
+			for _, symbol := range old.Implements {
+				if kept && lo.Contains(cur.Implements, symbol) {
+					continue
+				}
+				if err := storage.Indexer.RemoveImplementsLink(symbol, id); err != nil {
+					fmt.Printf("⚠️ Index Error: %v\n", err)
+				}
+			}
+		}
+		if !kept {
+			removed = append(removed, id)
+		}
+	}
+
+	if err := storage.DeleteChunks(removed...); err != nil {
+		fmt.Printf("❌ DB Error: %v\n", err)
+	}
+	return removed
+}
+
+// pruneDeletedFiles 清理 root 下磁盘上已不存在的文件的全部 Chunk 与元数据
+func (g *staleCollector) pruneDeletedFiles(root string) []string {
+	return g.pruneFiles(func(path string) bool {
+		return underRoot(path, root) && !fileExists(path)
+	})
+}
+
+// pruneOutsideRoots 清理不在任何已配置 root 下 (例如 root 已被移出配置) 或已被删除的文件
+// roots 为空时只清理已删除的文件，避免误清空整个索引
+func (g *staleCollector) pruneOutsideRoots(roots []string) []string {
+	return g.pruneFiles(func(path string) bool {
+		if !fileExists(path) {
+			return true
+		}
+		return len(roots) > 0 && !lo.SomeBy(roots, func(root string) bool { return underRoot(path, root) })
+	})
+}
+
+// pruneFiles 删除 FileMetaKey 中 stale 判定为真的文件的全部 Chunk 与元数据，返回被删除的 ChunkID
+func (g *staleCollector) pruneFiles(stale func(path string) bool) []string {
+	metas, err := storage.FileMetaKey.HGetAll()
+	if err != nil {
+		fmt.Printf("⚠️ Failed to load file meta: %v\n", err)
+		return nil
+	}
+
+	var removed, prunedFiles []string
+	for path, meta := range metas {
+		if !stale(path) {
+			continue
+		}
+		if meta != nil {
+			prev := g.loadChunks(lo.Keys(meta.ChunkHashes))
+			removed = append(removed, g.removeStale(prev, nil)...)
+		}
+		prunedFiles = append(prunedFiles, path)
+	}
+
+	if err := storage.DeleteFileRecords(prunedFiles...); err != nil {
+		fmt.Printf("❌ DB Error: %v\n", err)
+	}
+	for _, path := range prunedFiles {
+		fmt.Printf("🗑️ Pruned file: %s\n", path)
+	}
+	return removed
+}
+
+// underRoot 判断 path 是否位于 root 下；两者均转为清理后的绝对路径再比较，
+// 因此 "./x" 与 Walk 产出的 "x/a.go" 能正确匹配，"/a/bc" 也不会被误判为 "/a/b" 下的文件
+func underRoot(path, root string) bool {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(absRoot, absPath)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return !os.IsNotExist(err)
+}
@@ -0,0 +1,298 @@
+package analysis
+
+import (
+	"bufio"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"sysevov2/config"
+	"sysevov2/utils"
+)
+
+// embeddedAnalyzer 内置的 TS 分析脚本，未配置 Indexer.TSAnalyzerScript 时释放到临时目录使用
+//
+//go:embed analyzer.js
+var embeddedAnalyzer []byte
+
+var (
+	analyzerScriptOnce sync.Once
+	analyzerScript     string
+	analyzerScriptErr  error
+)
+
+// resolveAnalyzerScript 返回分析脚本的绝对路径：优先使用配置，否则释放内置脚本
+func resolveAnalyzerScript() (string, error) {
+	analyzerScriptOnce.Do(func() {
+		if path := config.Indexer.TSAnalyzerScript; path != "" {
+			if analyzerScript, analyzerScriptErr = filepath.Abs(path); analyzerScriptErr != nil {
+				return
+			}
+			if _, err := os.Stat(analyzerScript); err != nil {
+				analyzerScriptErr = fmt.Errorf("TS analyzer not found at: %s", analyzerScript)
+			}
+			return
+		}
+		// 文件名带内容哈希，升级后不会误用旧版本脚本
+		analyzerScript = filepath.Join(os.TempDir(), "sysevo-analyzer-"+utils.ContentHash(embeddedAnalyzer)+".js")
+		if _, err := os.Stat(analyzerScript); err == nil {
+			return
+		}
+		analyzerScriptErr = os.WriteFile(analyzerScript, embeddedAnalyzer, 0644)
+	})
+	return analyzerScript, analyzerScriptErr
+}
+
+// tsRawChunk analyzer.js 输出的单个 Chunk
+type tsRawChunk struct {
+	Name              string   `json:"name"` // 符号名: "Func" 或 "Class.method"
+	Type              string   `json:"type"` // JSON 中的 Type 现在是字符串
+	Skeleton          string   `json:"skeleton"`
+	Body              string   `json:"body"`
+	SymbolsReferenced []string `json:"symbols_referenced"`
+	Imports           []string `json:"imports"`    // 用到的 import 语句；文件头为全部 import
+	Implements        []string `json:"implements"` // class/interface 的 implements 与 extends 目标
+	Start             int      `json:"start"`      // 字节偏移 [Start, End)
+	End               int      `json:"end"`
+}
+
+type tsRequest struct {
+	ID   int64  `json:"id"`
+	Path string `json:"path"`
+	// Content 非 nil 时分析该内容而非磁盘文件 (索引时已读取的内容、editing 定位未落盘的内容)；
+	// 空内容 (如被 DELETE 清空的暂存文件) 同样发送，不会退回读取磁盘
+	Content *string `json:"content,omitempty"`
+	// Check 为 true 时只做语法检查，响应 Diagnostics 而非 Chunks
+	Check bool `json:"check,omitempty"`
+}
+
+type tsResponse struct {
+	ID          int64          `json:"id"`
+	Chunks      []tsRawChunk   `json:"chunks"`
+	Diagnostics []TSDiagnostic `json:"diagnostics"`
+	Error       string         `json:"error"`
+}
+
+// TSDiagnostic 一条 TS/JS 语法错误，行列从 1 开始 (无位置信息时为 0)
+type TSDiagnostic struct {
+	Line    int    `json:"line"`
+	Column  int    `json:"column"`
+	Message string `json:"message"`
+}
+
+func (d TSDiagnostic) String() string {
+	return fmt.Sprintf("%d:%d: %s", d.Line, d.Column, d.Message)
+}
+
+// tsWorker 一个常驻的 `node analyzer.js --server` 进程，同一时刻只处理一个请求
+type tsWorker struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout *bufio.Reader
+	nextID int64
+}
+
+func startTSWorker() (*tsWorker, error) {
+	script, err := resolveAnalyzerScript()
+	if err != nil {
+		return nil, err
+	}
+
+	node := config.Indexer.NodeBinary
+	if node == "" {
+		node = "node"
+	}
+	cmd := exec.Command(node, script, "--server")
+	cmd.Stderr = os.Stderr
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("start TS analyzer failed: %v", err)
+	}
+	return &tsWorker{cmd: cmd, stdin: stdin, stdout: bufio.NewReader(stdout)}, nil
+}
+
+// request 发送一个请求并等待响应
+// 返回的 error 若为 *tsWorkerCrash，说明进程已不可用，需要重启
+func (w *tsWorker) request(r tsRequest) (*tsResponse, error) {
+	w.nextID++
+	r.ID = w.nextID
+	req, _ := json.Marshal(r)
+	if _, err := w.stdin.Write(append(req, '\n')); err != nil {
+		return nil, &tsWorkerCrash{err: err}
+	}
+
+	line, err := w.stdout.ReadBytes('\n')
+	if err != nil {
+		return nil, &tsWorkerCrash{err: err}
+	}
+	var resp tsResponse
+	if err := json.Unmarshal(line, &resp); err != nil {
+		// 输出流已错位，无法再与后续请求对应
+		return nil, &tsWorkerCrash{err: fmt.Errorf("json parse failed: %v | output: %s", err, line)}
+	}
+	if resp.ID != w.nextID {
+		return nil, &tsWorkerCrash{err: fmt.Errorf("response id mismatch: want %d, got %d", w.nextID, resp.ID)}
+	}
+	if resp.Error != "" {
+		return nil, fmt.Errorf("analyzer error: %s", resp.Error)
+	}
+	return &resp, nil
+}
+
+// tsWorkerExitTimeout 关闭 stdin 后等待 Node 进程自行退出的时间，超时则强制结束
+const tsWorkerExitTimeout = 5 * time.Second
+
+// close 关闭 stdin 让进程自行退出并回收；超时未退出时 Kill 后再回收
+func (w *tsWorker) close() {
+	w.stdin.Close()
+	done := make(chan error, 1)
+	go func() { done <- w.cmd.Wait() }()
+	select {
+	case <-done:
+	case <-time.After(tsWorkerExitTimeout):
+		fmt.Printf("⚠️ TS analyzer did not exit within %s, killing\n", tsWorkerExitTimeout)
+		w.cmd.Process.Kill()
+		<-done
+	}
+}
+
+// tsWorkerCrash 进程级故障 (退出、管道断开、输出错位)
+type tsWorkerCrash struct {
+	err error
+}
+
+func (e *tsWorkerCrash) Error() string {
+	return fmt.Sprintf("TS analyzer worker crashed: %v", e.err)
+}
+
+// tsWorkerPool 固定容量的 worker 池；槽位为 nil 表示尚未启动或已崩溃，取用时按需启动
+type tsWorkerPool struct {
+	slots chan *tsWorker
+}
+
+func newTSWorkerPool(size int) *tsWorkerPool {
+	if size <= 0 {
+		size = 1
+	}
+	pool := &tsWorkerPool{slots: make(chan *tsWorker, size)}
+	for i := 0; i < size; i++ {
+		pool.slots <- nil
+	}
+	return pool
+}
+
+// analyze 取一个空闲 worker 处理文件 (content 为 nil 时读磁盘)
+func (p *tsWorkerPool) analyze(path string, content []byte) ([]tsRawChunk, error) {
+	resp, err := p.request(tsRequest{Path: path, Content: requestContent(content)})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Chunks, nil
+}
+
+// checkSyntax 对内容做语法检查，返回语法错误 (无错误时为空)
+func (p *tsWorkerPool) checkSyntax(path string, content []byte) ([]TSDiagnostic, error) {
+	resp, err := p.request(tsRequest{Path: path, Content: requestContent(content), Check: true})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Diagnostics, nil
+}
+
+// requestContent content 为 nil 时不发送 (sidecar 读磁盘)，否则原样发送 (含空内容)
+func requestContent(content []byte) *string {
+	if content == nil {
+		return nil
+	}
+	text := string(content)
+	return &text
+}
+
+// request 取一个空闲 worker 处理请求；worker 崩溃时重启并重试一次
+func (p *tsWorkerPool) request(r tsRequest) (*tsResponse, error) {
+	w := <-p.slots
+	defer func() { p.slots <- w }()
+
+	for attempt := 0; ; attempt++ {
+		if w == nil {
+			var err error
+			if w, err = startTSWorker(); err != nil {
+				return nil, err
+			}
+		}
+
+		resp, err := w.request(r)
+		if _, crashed := err.(*tsWorkerCrash); !crashed {
+			return resp, err
+		}
+
+		fmt.Printf("⚠️ %v, restarting\n", err)
+		w.cmd.Process.Kill()
+		w.cmd.Wait()
+		w = nil
+		if attempt > 0 {
+			// 连续崩溃多半是该文件触发的，交给调用方跳过
+			return nil, err
+		}
+	}
+}
+
+// close 等待所有 worker 归还后逐个关闭
+func (p *tsWorkerPool) close() {
+	for i := 0; i < cap(p.slots); i++ {
+		if w := <-p.slots; w != nil {
+			w.close()
+		}
+	}
+}
+
+var (
+	tsPoolMutex sync.Mutex
+	tsPool      *tsWorkerPool
+)
+
+// currentTSPool 返回全局 worker 池，未初始化时创建单 worker 池
+func currentTSPool() *tsWorkerPool {
+	tsPoolMutex.Lock()
+	defer tsPoolMutex.Unlock()
+	if tsPool == nil {
+		tsPool = newTSWorkerPool(1)
+	}
+	return tsPool
+}
+
+// resetTSPool 以新容量替换全局 worker 池并关闭旧池 (须在没有进行中的索引时调用)
+func resetTSPool(size int) {
+	tsPoolMutex.Lock()
+	old := tsPool
+	tsPool = newTSWorkerPool(size)
+	tsPoolMutex.Unlock()
+	if old != nil {
+		old.close()
+	}
+}
+
+// shutdownTSPool 关闭全局 worker 池中的所有 Node 进程
+func shutdownTSPool() {
+	tsPoolMutex.Lock()
+	old := tsPool
+	tsPool = nil
+	tsPoolMutex.Unlock()
+	if old != nil {
+		old.close()
+	}
+}
@@ -79,7 +79,7 @@ func (realm *EvoRealm) LoadOneXmlFile(path, gitdiffFile string) string {
 	}
 	if gitdiffFile != "" {
 		diffs := GitDiffs{}
-		toml.DecodeFile(path, &diffs)
+		toml.DecodeFile(gitdiffFile, &diffs)
 		if len(diffs.Diffs) > 0 {
 			var gitdiffs strings.Builder
 			for i := 0; i < len(diffs.Diffs) && i < 5; i++ {
@@ -105,10 +105,7 @@ func (realm *EvoRealm) LoadProjectFiles(fileKeepMap map[string]bool) string {
 			}
 		}
 		// gitdiffs file, locates in <realm.RootPath>/.evo
-		//ensure .evo dir exists
-		dir := strings.TrimRight(realm.RootPath, "/") + "/.evo"
-		os.MkdirAll(dir, 0755)
-		gitdiffHistoryFile := dir + "/" + strings.Join(strings.Split(relativePath, "/")[1:], "--")
+		gitdiffHistoryFile := realm.EvoFile(EvoUnifiedDiffFormat, path)
 
 		allFileInfo.WriteString(realm.LoadOneXmlFile(path, gitdiffHistoryFile))
 		return nil
@@ -144,6 +141,24 @@ func (selected EvoRealmSelected) LoadAllEvoProjects(KeepFileNames ...string) str
 
 var AllEvoRealmsInFile map[string]*EvoRealm
 
+// RealmOf 返回包含 path 的 Realm (多个 Realm 嵌套时取根路径最长者)；不属于任何 Realm 时返回 nil
+func RealmOf(path string) *EvoRealm {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	var found *EvoRealm
+	for _, realm := range AllEvoRealmsInFile {
+		root, err := filepath.Abs(realm.RootPath)
+		if err != nil || (path != root && !strings.HasPrefix(path, root+"/")) {
+			continue
+		}
+		if found == nil || len(realm.RootPath) > len(found.RootPath) {
+			found = realm
+		}
+	}
+	return found
+}
+
 type FileData struct {
 	Path    string
 	Realm   *EvoRealm
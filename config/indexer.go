@@ -0,0 +1,32 @@
+package config
+
+import (
+	dconfig "github.com/doptime/config"
+)
+
+// IndexerSettings 索引器配置，对应 config.toml 中的 [Indexer] 段
+type IndexerSettings struct {
+	// TypedGo 为 true 时使用 go/packages 整包加载 Go 代码 (完整类型信息)，
+	// 引用符号记录为全限定名，如 "sysevov2/storage.DirtyIndexClient.AddSymbolLink"
+	// 加载失败时自动回退到逐文件的 go/parser 模式
+	TypedGo bool
+	// Parsers 启用的解析器扩展名白名单，如 [".go", ".ts", ".tsx"]；为空表示启用全部已注册解析器
+	Parsers []string
+	// TSAnalyzerScript analyzer.js 路径；为空时使用二进制内置 (go:embed) 的脚本
+	TSAnalyzerScript string
+	// NodeBinary node 可执行文件，默认 "node"
+	NodeBinary string
+	// Embeddings 为 true 时索引阶段为变更的 Chunk 计算语义向量 (utils.GetEmbedding)
+	// 服务不可用时本轮索引自动跳过，L1 只使用词法 (BM25) 检索
+	Embeddings bool
+}
+
+var Indexer = IndexerSettings{
+	TypedGo:    true,
+	NodeBinary: "node",
+	Embeddings: true,
+}
+
+func init() {
+	dconfig.LoadItemFromToml("Indexer", &Indexer)
+}
@@ -0,0 +1,20 @@
+package config
+
+import (
+	dconfig "github.com/doptime/config"
+)
+
+// TokenizerSettings Token 计数配置，对应 config.toml 中的 [Tokenizer] 段
+type TokenizerSettings struct {
+	// Dir tiktoken 格式的 BPE 词表目录 (如 cl100k_base.tiktoken、o200k_base.tiktoken、qwen.tiktoken)
+	// 词表不随仓库分发，下载地址见 llm.TiktokenSources；缺少模型对应的词表时使用启发式估算，首次使用时打印告警
+	Dir string
+}
+
+var Tokenizer = TokenizerSettings{
+	Dir: "tokenizers",
+}
+
+func init() {
+	dconfig.LoadItemFromToml("Tokenizer", &Tokenizer)
+}
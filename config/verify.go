@@ -0,0 +1,24 @@
+package config
+
+import (
+	dconfig "github.com/doptime/config"
+)
+
+// VerifySettings 修改落盘后的编译校验配置，对应 config.toml 中的 [Verify] 段
+type VerifySettings struct {
+	// Enabled 为 true 时 GoalRunner 在应用修改后对受影响的 Go 包做类型检查、对 TS 项目运行 tsc --noEmit
+	Enabled bool
+	// MaxRepairRounds 出现新的编译错误时让编辑模型修复的最大轮数，仍失败则回滚全部修改
+	MaxRepairRounds int
+	// TscBinary tsc 可执行文件；为空时依次尝试项目的 node_modules/.bin/tsc 与 PATH 中的 tsc，均不存在时跳过 TS 校验
+	TscBinary string
+}
+
+var Verify = VerifySettings{
+	Enabled:         true,
+	MaxRepairRounds: 2,
+}
+
+func init() {
+	dconfig.LoadItemFromToml("Verify", &Verify)
+}
@@ -0,0 +1,425 @@
+package context
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"sysevov2/models"
+)
+
+// Tier Chunk 在上下文中的呈现级别，数值越小越完整
+type Tier int
+
+const (
+	TierFull              Tier = iota // 完整 Body，可修改
+	TierLiteralsElided                // 长字面量表 (数组、map、多行字符串) 只保留开头几项
+	TierClosuresCollapsed             // 在上一级基础上折叠嵌套闭包
+	TierDocOnly                       // 文档注释 + 签名
+	TierSkeleton                      // 仅签名
+)
+
+func (t Tier) String() string {
+	switch t {
+	case TierFull:
+		return "full"
+	case TierLiteralsElided:
+		return "literals_elided"
+	case TierClosuresCollapsed:
+		return "closures_collapsed"
+	case TierDocOnly:
+		return "doc_only"
+	case TierSkeleton:
+		return "skeleton"
+	}
+	return fmt.Sprintf("tier(%d)", int(t))
+}
+
+const (
+	literalKeepElements = 3 // 字面量表保留的前几项
+	literalMinLines     = 8 // 跨越行数超过该值的字面量才省略
+	closureMinLines     = 3 // 函数体超过该行数的闭包才折叠
+)
+
+// rendering Chunk 在某一级别下的 Body
+type rendering struct {
+	tier Tier
+	body string
+}
+
+// renderTiers 生成 Chunk 在 [minTier, TierSkeleton] 区间内的各级 Body (从完整到精简)
+// 较精简的级别若没有比上一级更短则跳过；非 TierFull 的 Body 带只读标记
+func renderTiers(chunk *models.Chunk, minTier Tier) []rendering {
+	literals, closures := compactionEdits(chunk)
+	texts := map[Tier]string{
+		TierFull:              chunk.Body,
+		TierLiteralsElided:    applyEdits(chunk.Body, literals),
+		TierClosuresCollapsed: applyEdits(chunk.Body, mergeEdits(closures, literals)),
+		TierDocOnly:           docOnly(chunk),
+		TierSkeleton:          signatureOnly(chunk.Skeleton),
+	}
+	banners := map[Tier]string{
+		TierLiteralsElided:    "Long literals elided",
+		TierClosuresCollapsed: "Long literals elided, closures collapsed",
+		TierDocOnly:           "Doc comment and signature only",
+		TierSkeleton:          "Signature Only",
+	}
+
+	var tiers []rendering
+	last := ""
+	for tier := minTier; tier <= TierSkeleton; tier++ {
+		text := texts[tier]
+		if len(tiers) > 0 && len(text) >= len(last) {
+			continue
+		}
+		last = text
+		if tier != TierFull {
+			text = fmt.Sprintf("%s %s\n// DO NOT MODIFY THIS CHUNK\n%s", ReadOnlyBanner, banners[tier], text)
+		}
+		tiers = append(tiers, rendering{tier: tier, body: text})
+	}
+	return tiers
+}
+
+// textEdit 将 Body 中 [start, end) 替换为 text
+type textEdit struct {
+	start, end int
+	text       string
+}
+
+func applyEdits(body string, edits []textEdit) string {
+	if len(edits) == 0 {
+		return body
+	}
+	sort.Slice(edits, func(i, j int) bool { return edits[i].start > edits[j].start })
+	for _, e := range edits {
+		body = body[:e.start] + e.text + body[e.end:]
+	}
+	return body
+}
+
+// mergeEdits 合并两组编辑，丢弃 inner 中落在 outer 某个编辑范围内的项
+func mergeEdits(outer, inner []textEdit) []textEdit {
+	merged := append([]textEdit{}, outer...)
+	for _, e := range inner {
+		contained := false
+		for _, o := range outer {
+			if e.start >= o.start && e.end <= o.end {
+				contained = true
+				break
+			}
+		}
+		if !contained {
+			merged = append(merged, e)
+		}
+	}
+	return merged
+}
+
+// compactionEdits 按语言计算字面量省略与闭包折叠的编辑
+func compactionEdits(chunk *models.Chunk) (literals, closures []textEdit) {
+	if chunk.Type == models.ChunkTypeHeader {
+		return nil, nil
+	}
+	switch strings.ToLower(filepath.Ext(chunk.FilePath)) {
+	case ".go":
+		return goCompactionEdits(chunk.Body)
+	case ".ts", ".tsx", ".js", ".jsx":
+		return tsCompactionEdits(chunk.Body)
+	}
+	return nil, nil
+}
+
+// goFragmentWrappers 单个 Chunk 不一定是完整声明 (分组 var/const/type 中的单个 spec)，依次尝试包裹后解析
+var goFragmentWrappers = [][2]string{
+	{"package p\n", ""},
+	{"package p\nvar (\n", "\n)"},
+	{"package p\nconst (\n", "\n)"},
+	{"package p\ntype (\n", "\n)"},
+}
+
+func goCompactionEdits(body string) (literals, closures []textEdit) {
+	fset := token.NewFileSet()
+	var file *ast.File
+	offset := 0
+	for _, w := range goFragmentWrappers {
+		f, err := parser.ParseFile(fset, "", w[0]+body+w[1], parser.SkipObjectResolution)
+		if err == nil {
+			file, offset = f, len(w[0])
+			break
+		}
+	}
+	if file == nil {
+		return nil, nil
+	}
+	pos := func(p token.Pos) int { return fset.Position(p).Offset - offset }
+	lines := func(from, to token.Pos) int { return fset.Position(to).Line - fset.Position(from).Line }
+
+	var walkLiterals func(node ast.Node)
+	walkLiterals = func(node ast.Node) {
+		ast.Inspect(node, func(n ast.Node) bool {
+			switch x := n.(type) {
+			case *ast.CompositeLit:
+				if len(x.Elts) <= literalKeepElements || lines(x.Lbrace, x.Rbrace) < literalMinLines {
+					return true
+				}
+				literals = append(literals, textEdit{
+					start: pos(x.Elts[literalKeepElements-1].End()),
+					end:   pos(x.Rbrace),
+					text: fmt.Sprintf(",\n%s/* ... %d more elements elided ... */\n%s",
+						lineIndent(body, pos(x.Elts[0].Pos())), len(x.Elts)-literalKeepElements, lineIndent(body, pos(x.Rbrace))),
+				})
+				for _, elt := range x.Elts[:literalKeepElements] {
+					walkLiterals(elt)
+				}
+				return false
+			case *ast.BasicLit:
+				if x.Kind == token.STRING && strings.HasPrefix(x.Value, "`") {
+					if edit, ok := elideStringLines(x.Value, pos(x.Pos()), "`"); ok {
+						literals = append(literals, edit)
+					}
+				}
+			}
+			return true
+		})
+	}
+	walkLiterals(file)
+
+	// 顶层 FuncDecl 自身保留，只折叠其中的 FuncLit
+	ast.Inspect(file, func(n ast.Node) bool {
+		lit, ok := n.(*ast.FuncLit)
+		if !ok || lines(lit.Body.Lbrace, lit.Body.Rbrace) <= closureMinLines {
+			return true
+		}
+		closures = append(closures, textEdit{
+			start: pos(lit.Body.Lbrace),
+			end:   pos(lit.Body.Rbrace) + 1,
+			text:  fmt.Sprintf("{ /* ... %d lines collapsed ... */ }", lines(lit.Body.Lbrace, lit.Body.Rbrace)-1),
+		})
+		return false
+	})
+	return literals, closures
+}
+
+// lineIndent 返回 offset 所在行的行首缩进
+func lineIndent(body string, offset int) string {
+	start := strings.LastIndex(body[:offset], "\n") + 1
+	line := body[start:]
+	return line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+}
+
+// elideStringLines 多行字符串只保留前几行；quote 为结束引号
+func elideStringLines(literal string, start int, quote string) (textEdit, bool) {
+	lines := strings.Split(literal, "\n")
+	if len(lines) <= literalMinLines {
+		return textEdit{}, false
+	}
+	kept := strings.Join(lines[:literalKeepElements], "\n")
+	return textEdit{
+		start: start,
+		end:   start + len(literal),
+		text:  fmt.Sprintf("%s\n... (%d lines elided) ...%s", kept, len(lines)-literalKeepElements, quote),
+	}, true
+}
+
+// tsBracket TS 文本扫描得到的一对括号
+type tsBracket struct {
+	open, close int
+	char        byte
+	commas      []int // 顶层逗号位置
+}
+
+var (
+	tsFunctionKeyword = regexp.MustCompile(`function\s*\*?\s*[\w$]*\s*(<[^()]*>)?\s*$`)
+	tsLiteralContext  = regexp.MustCompile(`(^|[=:(,\[?]|return)\s*$`)
+)
+
+// tsCompactionEdits TS/JS 没有可用的 Go 侧 AST，按括号扫描 (跳过字符串、注释与模板字符串) 识别:
+// 字面量表: 前面是 = : ( , [ return 的 [...] 或 {...}；闭包: 前面是 => 或 function(...) 的 {...}
+func tsCompactionEdits(body string) (literals, closures []textEdit) {
+	brackets := scanTSBrackets(body)
+	lineOf := func(i int) int { return strings.Count(body[:i], "\n") }
+
+	for _, b := range brackets {
+		spanLines := lineOf(b.close) - lineOf(b.open)
+		before := strings.TrimRight(body[:b.open], " \t\r\n")
+
+		if b.char == '{' && spanLines > closureMinLines && isTSClosureBody(body, before, brackets) {
+			closures = append(closures, textEdit{
+				start: b.open,
+				end:   b.close + 1,
+				text:  fmt.Sprintf("{ /* ... %d lines collapsed ... */ }", spanLines-1),
+			})
+			continue
+		}
+
+		if spanLines >= literalMinLines && len(b.commas) >= literalKeepElements && tsLiteralContext.MatchString(before) {
+			remaining := len(b.commas) - literalKeepElements + 1
+			// 末尾逗号 (trailing comma) 后没有元素
+			if strings.TrimSpace(body[b.commas[len(b.commas)-1]+1:b.close]) == "" {
+				remaining--
+			}
+			if remaining <= 0 {
+				continue
+			}
+			literals = append(literals, textEdit{
+				start: b.commas[literalKeepElements-1] + 1,
+				end:   b.close,
+				text: fmt.Sprintf("\n%s/* ... %d more elements elided ... */\n%s",
+					lineIndent(body, b.commas[0]), remaining, lineIndent(body, b.close)),
+			})
+		}
+	}
+
+	// 只保留最外层的编辑
+	return outermost(literals), outermost(closures)
+}
+
+// isTSClosureBody 判断 { 是否为箭头函数或函数表达式的函数体 (不含 Chunk 自身的顶层函数体)
+func isTSClosureBody(body, before string, brackets []tsBracket) bool {
+	if strings.HasSuffix(before, "=>") {
+		return true
+	}
+	if !strings.HasSuffix(before, ")") {
+		return false
+	}
+	closeParen := len(before) - 1
+	for _, b := range brackets {
+		if b.char == '(' && b.close == closeParen {
+			prefix := body[:b.open]
+			if !tsFunctionKeyword.MatchString(prefix) {
+				return false
+			}
+			// 顶层 function 声明即 Chunk 本身，不折叠
+			return !isTSDeclarationStart(tsFunctionKeyword.ReplaceAllString(prefix, ""))
+		}
+	}
+	return false
+}
+
+// isTSDeclarationStart 去掉 function 关键字后剩下的前缀只有注释与修饰符时，说明是顶层声明
+func isTSDeclarationStart(prefix string) bool {
+	lines := strings.Split(prefix, "\n")
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "//") || strings.HasPrefix(line, "/*") || strings.HasPrefix(line, "*") {
+			continue
+		}
+		for _, word := range strings.Fields(line) {
+			switch word {
+			case "export", "default", "async", "declare":
+			default:
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func outermost(edits []textEdit) []textEdit {
+	var result []textEdit
+	for _, e := range edits {
+		inside := false
+		for _, o := range edits {
+			if o != e && e.start >= o.start && e.end <= o.end {
+				inside = true
+				break
+			}
+		}
+		if !inside {
+			result = append(result, e)
+		}
+	}
+	return result
+}
+
+// scanTSBrackets 扫描配对的 () [] {}，跳过字符串、模板字符串与注释；模板中的 ${} 不计入
+func scanTSBrackets(src string) []tsBracket {
+	var result []tsBracket
+	var stack []*tsBracket
+	for i := 0; i < len(src); i++ {
+		c := src[i]
+		switch {
+		case c == '/' && i+1 < len(src) && src[i+1] == '/':
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+		case c == '/' && i+1 < len(src) && src[i+1] == '*':
+			end := strings.Index(src[i+2:], "*/")
+			if end < 0 {
+				return result
+			}
+			i += end + 3
+		case c == '"' || c == '\'' || c == '`':
+			for i++; i < len(src) && src[i] != c; i++ {
+				if src[i] == '\\' {
+					i++
+				}
+			}
+		case c == '(' || c == '[' || c == '{':
+			stack = append(stack, &tsBracket{open: i, char: c})
+		case c == ')' || c == ']' || c == '}':
+			if len(stack) == 0 {
+				continue
+			}
+			top := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			top.close = i
+			result = append(result, *top)
+		case c == ',':
+			if len(stack) > 0 {
+				top := stack[len(stack)-1]
+				top.commas = append(top.commas, i)
+			}
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].open < result[j].open })
+	return result
+}
+
+// docOnly 文档注释 + 签名: 函数取 Skeleton，其余声明取首行
+// Go 函数的 Body 从 func 关键字开始，不含 fn.Doc；其文档注释由 go/printer 输出在 Skeleton 开头，从那里取
+func docOnly(chunk *models.Chunk) string {
+	doc, code := leadingComments(chunk.Body)
+	lines := strings.Split(chunk.Body, "\n")
+
+	var signature string
+	if chunk.Type == models.ChunkTypeFunction || chunk.Type == models.ChunkTypeMethod {
+		skeletonDoc, skeletonCode := leadingComments(chunk.Skeleton)
+		if len(skeletonDoc) > 0 {
+			doc = skeletonDoc
+		}
+		signature = strings.Join(strings.Split(chunk.Skeleton, "\n")[skeletonCode:], "\n")
+	} else if code < len(lines) {
+		signature = lines[code]
+		if code < len(lines)-1 {
+			signature += " ... }"
+		}
+	}
+	return strings.TrimSpace(strings.Join(append(doc, signature), "\n"))
+}
+
+// signatureOnly 去掉 Skeleton 开头的文档注释，只保留签名
+func signatureOnly(skeleton string) string {
+	_, code := leadingComments(skeleton)
+	return strings.TrimSpace(strings.Join(strings.Split(skeleton, "\n")[code:], "\n"))
+}
+
+// leadingComments 返回开头的注释 (及空) 行与首个代码行的行号
+func leadingComments(text string) ([]string, int) {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "//") || strings.HasPrefix(trimmed, "/*") ||
+			strings.HasPrefix(trimmed, "*") {
+			continue
+		}
+		return lines[:i], i
+	}
+	return lines, len(lines)
+}
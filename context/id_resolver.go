@@ -0,0 +1,204 @@
+package context
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"sysevov2/models"
+	"sysevov2/utils"
+
+	"github.com/samber/lo"
+)
+
+// idResolver 将 LLM 返回的 Chunk ID 校正为候选集中真实存在的 ID
+// 依次尝试: 精确匹配 -> 清理空白/引号后匹配 -> 路径后缀匹配 -> 符号查找 -> 编辑距离
+type idResolver struct {
+	known map[string]bool
+	ids   []string
+	// bySymbol: 符号别名 -> ChunkIDs
+	// 别名包括 ID 中的符号 ("pkg.User.Save")、去掉包名的符号 ("User.Save") 以及 SymbolsDefined
+	bySymbol map[string][]string
+}
+
+func newIDResolver(chunks []*models.Chunk) *idResolver {
+	r := &idResolver{known: make(map[string]bool), bySymbol: make(map[string][]string)}
+	for _, c := range chunks {
+		if r.known[c.ID] {
+			continue
+		}
+		r.known[c.ID] = true
+		r.ids = append(r.ids, c.ID)
+
+		_, symbol, _ := models.SplitChunkID(c.ID)
+		aliases := append([]string{symbol, stripPackage(symbol)}, c.SymbolsDefined...)
+		for _, alias := range lo.Uniq(aliases) {
+			if alias != "" {
+				r.bySymbol[alias] = append(r.bySymbol[alias], c.ID)
+			}
+		}
+	}
+	sort.Strings(r.ids)
+	return r
+}
+
+// resolveAll 校正一组 ID，返回去重后的有效 ID 与无法解析的原始 ID
+func (r *idResolver) resolveAll(raw []string) (resolved, unresolved []string) {
+	for _, id := range raw {
+		match, ok := r.resolve(id)
+		if !ok {
+			unresolved = append(unresolved, id)
+			continue
+		}
+		if match != id {
+			fmt.Printf("🩹 Repaired chunk ID %q -> %s\n", id, match)
+		}
+		resolved = append(resolved, match)
+	}
+	if len(unresolved) > 0 {
+		fmt.Printf("⚠️ %d chunk IDs could not be resolved: %v\n", len(unresolved), unresolved)
+	}
+	return lo.Uniq(resolved), unresolved
+}
+
+func (r *idResolver) resolve(raw string) (string, bool) {
+	if r.known[raw] {
+		return raw, true
+	}
+	id := cleanChunkID(raw)
+	if id == "" {
+		return "", false
+	}
+	if r.known[id] {
+		return id, true
+	}
+	if match, ok := r.pick(id, r.suffixMatches(id)); ok {
+		return match, true
+	}
+	if match, ok := r.pick(id, r.symbolMatches(id)); ok {
+		return match, true
+	}
+	return r.nearest(id)
+}
+
+// cleanChunkID 去除模型常见的包装: 引号/反引号、"ID:" 前缀、"./" 前缀以及内部空白
+func cleanChunkID(raw string) string {
+	id := strings.Trim(strings.TrimSpace(raw), "`'\"")
+	id = strings.TrimSpace(strings.TrimPrefix(id, "ID:"))
+	id = strings.Join(strings.Fields(id), "")
+	return strings.TrimPrefix(id, "./")
+}
+
+// suffixMatches 路径不完整 (缺目录或缺整个路径) 或多出前缀 (绝对路径) 时按边界对齐的后缀匹配
+func (r *idResolver) suffixMatches(id string) []string {
+	return lo.Filter(r.ids, func(known string, _ int) bool {
+		return hasBoundarySuffix(known, id) || hasBoundarySuffix(id, known)
+	})
+}
+
+func hasBoundarySuffix(s, suffix string) bool {
+	if len(suffix) >= len(s) || !strings.HasSuffix(s, suffix) {
+		return false
+	}
+	prev := s[len(s)-len(suffix)-1]
+	return prev == '/' || prev == ':'
+}
+
+// symbolMatches 按符号别名查找，保留序号一致的结果
+func (r *idResolver) symbolMatches(id string) []string {
+	_, symbol, ordinal := models.SplitChunkID(id)
+	matches := r.bySymbol[symbol]
+	if len(matches) == 0 {
+		matches = r.bySymbol[stripPackage(symbol)]
+	}
+	return lo.Filter(matches, func(known string, _ int) bool {
+		_, _, n := models.SplitChunkID(known)
+		return n == ordinal
+	})
+}
+
+// pick 唯一匹配直接采用；多个匹配时取与原始 ID 编辑距离唯一最小者
+func (r *idResolver) pick(id string, matches []string) (string, bool) {
+	matches = lo.Uniq(matches)
+	switch len(matches) {
+	case 0:
+		return "", false
+	case 1:
+		return matches[0], true
+	}
+	return closest(id, matches, -1)
+}
+
+// nearest 在全部 ID 中取编辑距离唯一最小且不超过阈值者，用于拼写错误
+func (r *idResolver) nearest(id string) (string, bool) {
+	return closest(id, r.ids, max(2, len(id)/10))
+}
+
+// closest 返回编辑距离最小的候选；并列或超出 limit (limit < 0 表示不限) 时失败
+func closest(id string, candidates []string, limit int) (string, bool) {
+	best, bestDist, tie := "", -1, false
+	for _, c := range candidates {
+		if limit >= 0 && abs(len(c)-len(id)) > limit {
+			continue
+		}
+		d := utils.EditDistance(id, c)
+		switch {
+		case bestDist < 0 || d < bestDist:
+			best, bestDist, tie = c, d, false
+		case d == bestDist:
+			tie = true
+		}
+	}
+	if bestDist < 0 || tie || (limit >= 0 && bestDist > limit) {
+		return "", false
+	}
+	return best, true
+}
+
+// stripPackage 去掉 Go 符号的包名前缀: "pkg.User.Save" -> "User.Save"；无前缀时返回空
+func stripPackage(symbol string) string {
+	if i := strings.Index(symbol, "."); i > 0 {
+		return symbol[i+1:]
+	}
+	return ""
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// idCorrection 构造重新提示时附带的纠正说明
+func idCorrection(unresolved []string) string {
+	return fmt.Sprintf("Your previous answer contained IDs that do not exist: %s\n"+
+		"Answer again and copy every ID exactly as it appears after \"ID:\" in the list above.",
+		strings.Join(unresolved, ", "))
+}
+
+// callResolvingIDs 执行一次返回 Chunk ID 的 agent 调用并校正结果
+// 无法解析的比例超过 UnresolvedIDTolerance 时附带纠正说明重新调用一次，两轮的有效 ID 取并集
+func (s *Selector) callResolvingIDs(resolver *idResolver, call func(correction string) ([]string, error)) ([]string, error) {
+	var resolved []string
+	correction := ""
+	for round := 0; ; round++ {
+		raw, err := call(correction)
+		if err != nil {
+			if round > 0 {
+				// 纠正轮失败时沿用首轮结果
+				return resolved, nil
+			}
+			return nil, err
+		}
+		ids, unresolved := resolver.resolveAll(raw)
+		resolved = lo.Uniq(append(resolved, ids...))
+
+		total := len(ids) + len(unresolved)
+		if round > 0 || len(unresolved) == 0 || float64(len(unresolved)) <= s.UnresolvedIDTolerance*float64(total) {
+			return resolved, nil
+		}
+		fmt.Printf("🔁 %d of %d picked IDs unresolved, re-prompting with correction\n", len(unresolved), total)
+		correction = idCorrection(unresolved)
+	}
+}
@@ -0,0 +1,176 @@
+package context
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"sysevov2/agent"
+	"sysevov2/llm"
+	"sysevov2/models"
+	"sysevov2/utils"
+
+	"github.com/samber/lo"
+)
+
+const (
+	// l1PromptReserve 单次 L1 调用中候选之外的固定开销估算 (模板、工具定义与输出)
+	l1PromptReserve = 4000
+	// minShardTokens 分片的下限，避免窗口过小时切出大量碎片
+	minShardTokens = 2000
+)
+
+// candidateEntry 候选在 L1 提示中的表示: ID + 截断后的 Skeleton
+func candidateEntry(c *models.Chunk) string {
+	// 截断过长的 Skeleton，防止单体过大
+	skel := c.Skeleton
+	if len(skel) > 300 {
+		skel = skel[:300] + "..."
+	}
+	return fmt.Sprintf("ID: %s\n%s\n---\n", c.ID, skel)
+}
+
+// shardEntries 按 Token 数 (tokens[i] 对应 entries[i]) 将候选顺序切分为不超过 budget 的分片
+func shardEntries(entries []string, tokens []int, budget int) [][]string {
+	var shards [][]string
+	var current []string
+	spent := 0
+	for i, entry := range entries {
+		if len(current) > 0 && spent+tokens[i] > budget {
+			shards = append(shards, current)
+			current, spent = nil, 0
+		}
+		current = append(current, entry)
+		spent += tokens[i]
+	}
+	if len(current) > 0 {
+		shards = append(shards, current)
+	}
+	return shards
+}
+
+// l1Budget 给定模型下单次 L1 调用可用于候选列表的 Token
+func l1Budget(model *llm.Model, fixed string) int {
+	return max(model.ContextTokens()-model.CountTokens(fixed)-l1PromptReserve, minShardTokens)
+}
+
+func countEach(model *llm.Model, entries []string) []int {
+	return lo.Map(entries, func(entry string, _ int) int { return model.CountTokens(entry) })
+}
+
+// selectCore L1 核心定位 (map-reduce)
+// 候选能放进单次调用时直接选择；否则按模型窗口分片，在 SelectionAgent.Models 间轮转并发选择 (map)，
+// 再把各分片选中的候选放在一起由 model 复选一次 (reduce)
+func (s *Selector) selectCore(intent string, candidates []*models.Chunk, model *llm.Model, trace *models.SelectionTrace) (*CoreSelectionResult, error) {
+	importantFiles := utils.WrapFilesInXML("ImportantFile", s.FilesMustInclude...)
+	fixed := importantFiles + intent
+
+	pool := s.SelectionAgent.Models
+	if len(pool) == 0 {
+		pool = []*llm.Model{model}
+	}
+	trace.Model = model.Name
+
+	resolver := newIDResolver(candidates)
+	entries := lo.Map(candidates, func(c *models.Chunk, _ int) string { return candidateEntry(c) })
+	// 按池中窗口最小的模型切分与计数，保证任一模型都能容纳分片
+	tightest := lo.MinBy(pool, func(a, b *llm.Model) bool { return l1Budget(a, fixed) < l1Budget(b, fixed) })
+	tokens := countEach(tightest, entries)
+	shards := shardEntries(entries, tokens, l1Budget(tightest, fixed))
+	trace.Shards = len(shards)
+	trace.Tokens.Candidates = lo.Sum(tokens)
+	// 单个分片即可容纳时由 model 直接选择 (model 不在池中时按它自己的窗口再确认一次)
+	if len(shards) <= 1 {
+		if tightest == model || len(shardEntries(entries, countEach(model, entries), l1Budget(model, fixed))) <= 1 {
+			return s.pickChunks(model, importantFiles, intent, strings.Join(entries, ""), resolver)
+		}
+	}
+
+	// Map: 各分片独立选择
+	fmt.Printf("🧩 L1 map: %d candidates in %d shards across %d models\n", len(entries), len(shards), len(pool))
+	results := make([]*CoreSelectionResult, len(shards))
+	errs := make([]error, len(shards))
+	roundRobin := llm.NewModelList("L1Shards", pool...)
+	sem := make(chan struct{}, max(s.ShardConcurrency, 1))
+	var wg sync.WaitGroup
+	for i, shard := range shards {
+		shardModel := roundRobin.SequentialPick()
+		wg.Add(1)
+		go func(i int, shard []string, shardModel *llm.Model) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			results[i], errs[i] = s.pickChunks(shardModel, importantFiles, intent, strings.Join(shard, ""), resolver)
+		}(i, shard, shardModel)
+	}
+	wg.Wait()
+
+	merged := &CoreSelectionResult{}
+	failed := 0
+	for i, res := range results {
+		if errs[i] != nil {
+			failed++
+			fmt.Printf("⚠️ L1 shard %d/%d failed: %v\n", i+1, len(shards), errs[i])
+			continue
+		}
+		merged.SelectedIDs = append(merged.SelectedIDs, res.SelectedIDs...)
+		merged.ContractChange = merged.ContractChange || res.ContractChange
+	}
+	if failed == len(shards) {
+		return nil, fmt.Errorf("all %d L1 shards failed: %w", len(shards), errs[0])
+	}
+	merged.SelectedIDs = lo.Uniq(merged.SelectedIDs)
+
+	// Reduce: 分片只看到局部候选，容易多选；将并集 (保持预排序顺序) 放在一起复选
+	pickedSet := lo.SliceToMap(merged.SelectedIDs, func(id string) (string, bool) { return id, true })
+	picked := lo.FilterMap(candidates, func(c *models.Chunk, _ int) (string, bool) {
+		return candidateEntry(c), pickedSet[c.ID]
+	})
+	fmt.Printf("🧩 L1 reduce: %d picks from %d shards\n", len(merged.SelectedIDs), len(shards)-failed)
+	if len(picked) == 0 {
+		return merged, nil
+	}
+	if len(shardEntries(picked, countEach(model, picked), l1Budget(model, fixed))) > 1 {
+		fmt.Printf("⚠️ L1 picks exceed the context window of %s, skipping final pass\n", model.Name)
+		return merged, nil
+	}
+
+	final, err := s.pickChunks(model, importantFiles, intent, strings.Join(picked, ""), resolver)
+	if err != nil {
+		fmt.Printf("⚠️ L1 final pass failed, keeping shard picks: %v\n", err)
+		return merged, nil
+	}
+	// 复选只在并集内收窄 (resolver 覆盖全部候选，这里再限定到并集)；一个都不选时视为复选无效
+	final.SelectedIDs = lo.Filter(final.SelectedIDs, func(id string, _ int) bool { return pickedSet[id] })
+	if len(final.SelectedIDs) == 0 {
+		return merged, nil
+	}
+	final.ContractChange = final.ContractChange || merged.ContractChange
+	return final, nil
+}
+
+// pickChunks 对一份候选列表调用一次 SelectionAgent，返回的 ID 经 resolver 校正
+func (s *Selector) pickChunks(model *llm.Model, importantFiles, intent, candidates string, resolver *idResolver) (*CoreSelectionResult, error) {
+	result := &CoreSelectionResult{}
+	ids, err := s.callResolvingIDs(resolver, func(correction string) ([]string, error) {
+		var picked []string
+		// Clone: 分片并发调用时各自持有独立的工具回调表
+		keyedAgent := s.SelectionAgent.Clone().UseTools(llm.NewTool("PickChunks", "Select necessary code chunks", func(res *CoreSelectionResult) {
+			picked = res.SelectedIDs
+			result.ContractChange = result.ContractChange || res.ContractChange
+		}))
+		err := keyedAgent.Call(map[string]any{
+			agent.UseModel:   model,
+			"ImportantFiles": importantFiles,
+			"Intent":         intent,
+			"Candidates":     candidates,
+			"Correction":     correction,
+		})
+		return picked, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("L1 selection failed: %w", err)
+	}
+	result.SelectedIDs = ids
+	return result, nil
+}
@@ -0,0 +1,101 @@
+package context
+
+import (
+	"fmt"
+	"sort"
+
+	"sysevov2/models"
+)
+
+// 打包优先级: 数值越小越先获得预算
+const (
+	priorityCore       = iota // L1 核心 (及契约变更的调用方)，只以完整 Body 出现且不会被丢弃
+	priorityHostStruct        // Core 方法的宿主类型
+	priorityKept              // 直接依赖的类型与负选择保留的依赖
+	priorityPruned            // 负选择未保留的依赖与远端类型，最多呈现到文档注释 + 签名
+)
+
+// packItem 待打包的 Chunk 及其可选呈现
+type packItem struct {
+	chunk    *models.Chunk
+	priority int
+	tiers    []rendering // 从完整到精简
+	tokens   []int       // tokens[i] 对应 tiers[i]
+	choice   int         // 选中的 tiers 下标；-1 表示因预算不足被丢弃
+}
+
+func newPackItem(chunk *models.Chunk, priority int, countTokens func(string) int) *packItem {
+	var tiers []rendering
+	switch priority {
+	case priorityCore:
+		tiers = renderTiers(chunk, TierFull)[:1]
+	case priorityPruned:
+		tiers = renderTiers(chunk, TierDocOnly)
+	default:
+		tiers = renderTiers(chunk, TierFull)
+	}
+	item := &packItem{chunk: chunk, priority: priority, tiers: tiers, tokens: make([]int, len(tiers))}
+	for i, r := range tiers {
+		item.tokens[i] = countTokens(r.body)
+	}
+	return item
+}
+
+// rendered 返回选中呈现对应的 Chunk (非完整呈现时为替换了 Body 的副本)
+func (it *packItem) rendered() *models.Chunk {
+	r := it.tiers[it.choice]
+	if r.tier == TierFull {
+		return it.chunk
+	}
+	compacted := *it.chunk
+	compacted.Body = r.body
+	return &compacted
+}
+
+// packChunks 在 budget 内为每个 Chunk 选择最完整的呈现 (budget <= 0 表示不限)
+// 先全部取最精简的呈现 (超出预算时从低优先级、体积大的开始丢弃)，
+// 再按优先级顺序逐个升级到剩余预算允许的最完整级别；返回实际占用的 Token
+func packChunks(items []*packItem, budget int) int {
+	spent := 0
+	for _, it := range items {
+		it.choice = len(it.tiers) - 1
+		spent += it.tokens[it.choice]
+	}
+
+	if budget > 0 && spent > budget {
+		dropOrder := append([]*packItem{}, items...)
+		sort.SliceStable(dropOrder, func(i, j int) bool {
+			if dropOrder[i].priority != dropOrder[j].priority {
+				return dropOrder[i].priority > dropOrder[j].priority
+			}
+			return dropOrder[i].tokens[dropOrder[i].choice] > dropOrder[j].tokens[dropOrder[j].choice]
+		})
+		for _, it := range dropOrder {
+			if spent <= budget || it.priority == priorityCore {
+				break
+			}
+			spent -= it.tokens[it.choice]
+			it.choice = -1
+		}
+		if spent > budget {
+			fmt.Printf("⚠️ Core chunks alone need %d tokens, exceeding the context budget of %d\n", spent, budget)
+		}
+	}
+
+	upgradeOrder := append([]*packItem{}, items...)
+	sort.SliceStable(upgradeOrder, func(i, j int) bool { return upgradeOrder[i].priority < upgradeOrder[j].priority })
+	for _, it := range upgradeOrder {
+		if it.choice <= 0 {
+			continue
+		}
+		current := it.tokens[it.choice]
+		for t := 0; t < it.choice; t++ {
+			if budget <= 0 || spent-current+it.tokens[t] <= budget {
+				spent += it.tokens[t] - current
+				it.choice = t
+				break
+			}
+		}
+	}
+	return spent
+}
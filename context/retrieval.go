@@ -0,0 +1,90 @@
+package context
+
+import (
+	"fmt"
+	"sort"
+
+	"sysevov2/models"
+	"sysevov2/search"
+	"sysevov2/storage"
+	"sysevov2/utils"
+)
+
+// rankCandidates 对 L1 候选预排序并截取前 CandidateTopK 个
+// 词法 (BM25) 与语义 (余弦相似度) 两路检索以 RRF 融合；embedding 服务不可用时只用词法一路，
+// 两路都未命中的 Chunk 按 ID 排在后面
+func (s *Selector) rankCandidates(intent string, chunks []*models.Chunk) []*models.Chunk {
+	byID := make(map[string]*models.Chunk, len(chunks))
+	for _, c := range chunks {
+		byID[c.ID] = c
+	}
+
+	var rankings [][]search.Scored
+	if lexical := s.lexicalRanking(intent, byID); len(lexical) > 0 {
+		rankings = append(rankings, lexical)
+	}
+	if semantic := s.semanticRanking(intent, byID); len(semantic) > 0 {
+		rankings = append(rankings, semantic)
+	}
+
+	var ranked []*models.Chunk
+	seen := make(map[string]bool)
+	for _, hit := range search.ReciprocalRankFusion(rankings...) {
+		ranked = append(ranked, byID[hit.ID])
+		seen[hit.ID] = true
+	}
+
+	var rest []*models.Chunk
+	for _, c := range chunks {
+		if !seen[c.ID] {
+			rest = append(rest, c)
+		}
+	}
+	sort.Slice(rest, func(i, j int) bool { return rest[i].ID < rest[j].ID })
+	ranked = append(ranked, rest...)
+
+	if s.CandidateTopK > 0 && len(ranked) > s.CandidateTopK {
+		ranked = ranked[:s.CandidateTopK]
+	}
+	return ranked
+}
+
+// lexicalRanking 基于索引阶段写入的词频做 BM25 排序 (完全离线)
+func (s *Selector) lexicalRanking(intent string, candidates map[string]*models.Chunk) []search.Scored {
+	allTerms, err := storage.ChunkTermsKey.HGetAll()
+	if err != nil {
+		fmt.Printf("⚠️ Failed to load lexical index: %v\n", err)
+		return nil
+	}
+
+	docs := make([]search.Document, 0, len(allTerms))
+	for id, t := range allTerms {
+		if _, ok := candidates[id]; ok && t != nil {
+			docs = append(docs, search.Document{ID: id, Terms: t.Terms, Length: t.Length})
+		}
+	}
+	return search.NewBM25Index(docs).Rank(intent)
+}
+
+// semanticRanking 按意图向量对已有向量的候选排序；服务或存储不可用时返回空
+func (s *Selector) semanticRanking(intent string, candidates map[string]*models.Chunk) []search.Scored {
+	query, err := utils.GetEmbedding(intent)
+	if err != nil {
+		fmt.Printf("⚠️ Intent embedding unavailable, skipping semantic ranking: %v\n", err)
+		return nil
+	}
+	embeddings, err := storage.ChunkEmbeddingKey.HGetAll()
+	if err != nil {
+		fmt.Printf("⚠️ Failed to load chunk embeddings: %v\n", err)
+		return nil
+	}
+
+	vectors := make(map[string][]float32, len(embeddings))
+	for id, e := range embeddings {
+		// 只使用与当前 Chunk 内容一致的向量
+		if c, ok := candidates[id]; ok && e != nil && e.ContentHash == c.ContentHash {
+			vectors[id] = e.Vector
+		}
+	}
+	return search.RankByVector(query, vectors)
+}
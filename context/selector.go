@@ -2,10 +2,13 @@ package context
 
 import (
 	"fmt"
+	"path/filepath"
+	"sort"
 	"strings"
 	"text/template"
 
 	"sysevov2/agent"
+	"sysevov2/analysis"
 	"sysevov2/llm"
 	"sysevov2/models"
 	"sysevov2/storage"
@@ -14,10 +17,14 @@ import (
 	"github.com/samber/lo"
 )
 
+// ReadOnlyBanner 降级为只读参考的 Chunk 的 Body 前缀
+const ReadOnlyBanner = "// [READ-ONLY REFERENCE]"
+
 // SelectedContext 封装最终的选择结果
 type SelectedContext struct {
 	Chunks    []*models.Chunk   // 包含 Core(Body), Type(Body), KeptDep(Body), PrunedDep(Skeleton)
 	FullFiles map[string]string // 路径 -> 文件内容 (被“升格”的文件)
+	RunID     string            // 本次选择的决策记录 (见 LoadTrace)
 }
 
 type Selector struct {
@@ -25,12 +32,33 @@ type Selector struct {
 	NegativeSelectionAgent *agent.Agent
 	FilesMustInclude       []string
 	PromotionThreshold     float64
+	// CallerDepth: 意图改变函数契约时，沿调用方向外扩展的层数
+	CallerDepth int
+	// ExpansionDepth: 依赖扩散的最大层数 (1 即只取直接依赖)
+	ExpansionDepth int
+	// ExpansionTokenBudget: 依赖扩散的 Token 上限，超出后停止纳入新依赖
+	ExpansionTokenBudget int
+	// CandidateTopK: L1 预排序后保留的候选数 (0 表示不限，全部候选分片送选)
+	CandidateTopK int
+	// ShardConcurrency: L1 分片并发调用数上限
+	ShardConcurrency int
+	// ContextTokenBudget: 最终上下文 (升格文件 + Chunks) 的 Token 上限，0 表示不限
+	// GoalRunner 按编辑模型的窗口设置
+	ContextTokenBudget int
+	// UnresolvedIDTolerance: 选择结果中无法解析的 ID 占比超过该值时，附带纠正说明重新提示一次
+	UnresolvedIDTolerance float64
 }
 
 type SelectionResult struct {
 	SelectedIDs []string `description:"The list of Chunk IDs that are strictly necessary."`
 }
 
+// CoreSelectionResult L1 核心定位的结果
+type CoreSelectionResult struct {
+	SelectedIDs    []string `description:"The list of Chunk IDs that are strictly necessary."`
+	ContractChange bool     `description:"True if the intent changes the signature or contract (parameters, return values, semantics) of a selected function/method/type, so its callers must be updated too."`
+}
+
 func NewSelector() *Selector {
 	// L1: 核心筛选 (Targeting)
 	t1 := template.Must(template.New("ContextSelector").Parse(`
@@ -50,6 +78,12 @@ Return the IDs of chunks that are strictly necessary to fulfill the intent.
 </Candidates>
 
 Return the Chunk IDs that must be modified or read in detail.
+Set ContractChange to true if the intent changes the signature or contract of a selected chunk, so that every caller must be updated as well.
+{{if .Correction}}
+<Correction>
+{{.Correction}}
+</Correction>
+{{end}}
 `))
 
 	// L2.5: 负选择 (Pruning)
@@ -73,6 +107,11 @@ Task: Decide which Dependencies need their IMPLEMENTATION (Body) vs which only n
 
 Return the IDs of dependencies where the BODY is essential (e.g., complex logic, potential side effects, or needs modification).
 If only the signature is needed for calling, DO NOT select it.
+{{if .Correction}}
+<Correction>
+{{.Correction}}
+</Correction>
+{{end}}
 `))
 
 	selAgent := agent.Create(t1).WithToolCallMutextRun().WithModels(llm.ModelDefault)
@@ -82,12 +121,34 @@ If only the signature is needed for calling, DO NOT select it.
 		SelectionAgent:         selAgent,
 		NegativeSelectionAgent: negAgent,
 		PromotionThreshold:     0.5,
+		CallerDepth:            1,
+		ExpansionDepth:         2,
+		ExpansionTokenBudget:   20000,
+		CandidateTopK:          0,
+		ShardConcurrency:       4,
+		UnresolvedIDTolerance:  0.2,
 	}
 }
 
-// SelectRelevantChunks 执行 Diamond Selection
+// SelectRelevantChunks 执行 Diamond Selection，并以 RunID 保存决策记录 (成功或失败均保存)
 func (s *Selector) SelectRelevantChunks(intent string, model *llm.Model) (*SelectedContext, error) {
+	trace := newSelectionTrace(intent)
+	selected, err := s.selectRelevantChunks(intent, model, trace)
+	if err != nil {
+		trace.Error = err.Error()
+	} else {
+		selected.RunID = trace.RunID
+	}
+	saveTrace(trace)
+	return selected, err
+}
+
+func (s *Selector) selectRelevantChunks(intent string, model *llm.Model, trace *models.SelectionTrace) (*SelectedContext, error) {
 	fmt.Printf("🧠 Selecting Context for: %.50s...\n", intent)
+	// Token 预算均按选择模型的词表计数
+	if model == nil {
+		model = llm.LoadbalancedPick(s.SelectionAgent.Models...)
+	}
 
 	// 1. 加载所有 Chunk
 	allChunksMap, err := storage.ChunkStorage.HGetAll()
@@ -96,58 +157,53 @@ func (s *Selector) SelectRelevantChunks(intent string, model *llm.Model) (*Selec
 	}
 	allChunks := lo.Values(allChunksMap)
 
-	// 2. 构建 L1 候选列表 (含过载保护)
-	var sb strings.Builder
-	const maxCandidateTokens = 40000 // 预留 Buffer 给 System Prompt 和 ToolDef
-	estimatedTokens := 0
-
-	for _, c := range allChunks {
-		// 截断过长的 Skeleton，防止单体过大
-		skel := c.Skeleton
-		if len(skel) > 300 {
-			skel = skel[:300] + "..."
-		}
-		entry := fmt.Sprintf("ID: %s\n%s\n---\n", c.ID, skel)
-
-		// 简单估算 Token (Char/4)
-		tokenCount := len(entry) / 4
-		if estimatedTokens+tokenCount > maxCandidateTokens {
-			sb.WriteString("\n... (Candidates truncated due to context limit) ...\n")
-			break
-		}
-		sb.WriteString(entry)
-		estimatedTokens += tokenCount
-	}
+	// 2. 构建 L1 候选列表 (按与意图的相关度预排序)
+	// 文件头不参与意图筛选，由 attachFileHeaders 按需附带
+	candidates := lo.Filter(allChunks, func(c *models.Chunk, _ int) bool { return c.Type != models.ChunkTypeHeader })
+	trace.CandidatePool = len(candidates)
+	candidates = s.rankCandidates(intent, candidates)
+	trace.Candidates = lo.Map(candidates, func(c *models.Chunk, _ int) string { return c.ID })
 
-	// 3. Level 1: 核心定位
-	var coreIDs []string
-	keyedAgent := s.SelectionAgent.UseTools(llm.NewTool("PickChunks", "Select necessary code chunks", func(res *SelectionResult) {
-		coreIDs = res.SelectedIDs
-	}))
-
-	err = keyedAgent.Call(map[string]any{
-		agent.UseModel:   model,
-		"ImportantFiles": utils.WrapFilesInXML("ImportantFile", s.FilesMustInclude...),
-		"Intent":         intent,
-		"Candidates":     sb.String(),
-	})
+	// 3. Level 1: 核心定位 (候选超出模型窗口时分片 map-reduce)
+	core, err := s.selectCore(intent, candidates, model, trace)
 	if err != nil {
-		return nil, fmt.Errorf("L1 selection failed: %w", err)
+		return nil, err
+	}
+	coreIDs, contractChange := core.SelectedIDs, core.ContractChange
+	trace.CoreIDs, trace.ContractChange = coreIDs, contractChange
+
+	// 契约变更: 调用方同样需要修改，并入 Core
+	if contractChange && s.CallerDepth > 0 {
+		callers := analysis.CallersClosure(coreIDs, s.CallerDepth)
+		fmt.Printf("📞 Contract change detected, pulling %d callers\n", len(callers))
+		trace.AddExpansion(models.TraceReasonCaller, lo.Without(lo.Keys(callers), coreIDs...)...)
+		coreIDs = lo.Uniq(append(coreIDs, lo.Keys(callers)...))
 	}
 
 	// 4. Level 2: 依赖扩散 + 【修复1】宿主结构体补全
-	// 先找出所有 1-Hop 依赖
-	depIDs := s.expandDependencies(coreIDs, allChunksMap)
+	// 先按跳数与引用频次做多层扩散 (受 Token 预算约束)
+	depIDs, hops := s.expandDependencies(coreIDs, allChunksMap, model.CountTokens)
 	// 再找出所有 Method 的宿主 Struct (防止“孤儿方法”)
 	hostStructIDs := s.ensureStructDefinitions(coreIDs, allChunksMap)
 
+	// 最后补全接口与实现 (以 Core 与直接依赖为起点)
+	directIDs := append(lo.Filter(depIDs, func(id string, _ int) bool { return hops[id] <= 1 }), coreIDs...)
+	implTypeIDs, implMethodIDs := s.linkImplementations(directIDs, allChunksMap)
+
 	// 合并并去重，同时移除 coreIDs 自身
-	allExpandedIDs := lo.Uniq(append(depIDs, hostStructIDs...))
+	allExpandedIDs := lo.Uniq(lo.Flatten([][]string{depIDs, hostStructIDs, implTypeIDs, implMethodIDs}))
 	allExpandedIDs = lo.Without(allExpandedIDs, coreIDs...)
+	trace.AddExpansion(models.TraceReasonDependency, depIDs...)
+	trace.AddExpansion(models.TraceReasonHostStruct, hostStructIDs...)
+	trace.AddExpansion(models.TraceReasonImplementation, append(implTypeIDs, implMethodIDs...)...)
+	for _, id := range trace.CoreIDs {
+		delete(trace.Expanded, id)
+	}
 
 	// 5. Level 2.5: 分类与负选择
 	var autoKeepIDs []string   // Structs/Interfaces
 	var reviewListIDs []string // Functions/Methods
+	var deepTypeIDs []string   // 第 2 跳及更远的类型，直接降级为 Skeleton
 
 	for _, id := range allExpandedIDs {
 		chunk, exists := allChunksMap[id]
@@ -156,8 +212,13 @@ func (s *Selector) SelectRelevantChunks(intent string, model *llm.Model) (*Selec
 		}
 		// 使用 models 常量判断
 		switch chunk.Type {
-		case models.ChunkTypeStruct, models.ChunkTypeInterface, models.ChunkTypeType, models.ChunkTypeClass:
-			autoKeepIDs = append(autoKeepIDs, id)
+		case models.ChunkTypeStruct, models.ChunkTypeInterface, models.ChunkTypeType, models.ChunkTypeClass,
+			models.ChunkTypeEnum, models.ChunkTypeVar, models.ChunkTypeConst:
+			if hops[id] > 1 {
+				deepTypeIDs = append(deepTypeIDs, id)
+			} else {
+				autoKeepIDs = append(autoKeepIDs, id)
+			}
 		default:
 			reviewListIDs = append(reviewListIDs, id)
 		}
@@ -182,34 +243,43 @@ func (s *Selector) SelectRelevantChunks(intent string, model *llm.Model) (*Selec
 		finalIDSet[id] = struct{}{}
 	}
 
-	// D. Pruned (Skeleton)
-	prunedIDs := lo.Without(reviewListIDs, keptReviewIDs...)
+	// D. Pruned (由打包阶段按预算决定呈现级别)
+	prunedIDs := append(lo.Without(reviewListIDs, keptReviewIDs...), deepTypeIDs...)
+	trace.SetVerdict(models.TraceVerdictAutoKeep, autoKeepIDs...)
+	trace.SetVerdict(models.TraceVerdictKept, keptReviewIDs...)
+	trace.SetVerdict(models.TraceVerdictPruned, lo.Without(reviewListIDs, keptReviewIDs...)...)
+	trace.SetVerdict(models.TraceVerdictDeepType, deepTypeIDs...)
 
 	// 7. 密度计算与自动升格
-	fileTotalCounts := make(map[string]int)
-	fileSelectedCounts := make(map[string]int)
+	// 密度 = 选中 Body 的 Token / 文件全部 Chunk 的 Token：少数几个大函数入选时，整文件的额外开销很小
+	fileTotalTokens := make(map[string]int)
+	fileSelectedTokens := make(map[string]int)
 
-	for _, c := range allChunks {
-		fileTotalCounts[c.FilePath]++
-	}
 	// 注意：只统计 Full Body 的命中率，Pruned Skeleton 不计入升格权重
 	for id := range finalIDSet {
 		if c, ok := allChunksMap[id]; ok {
-			fileSelectedCounts[c.FilePath]++
+			fileSelectedTokens[c.FilePath] += model.CountTokens(c.Body)
+		}
+	}
+	for _, c := range allChunks {
+		if _, selected := fileSelectedTokens[c.FilePath]; selected && c.Type != models.ChunkTypeHeader {
+			fileTotalTokens[c.FilePath] += model.CountTokens(c.Body)
 		}
 	}
 
 	filesToPromote := make(map[string]bool)
-	for filePath, selectedCount := range fileSelectedCounts {
-		totalCount := fileTotalCounts[filePath]
-		if totalCount == 0 {
+	for filePath, selectedTokens := range fileSelectedTokens {
+		totalTokens := fileTotalTokens[filePath]
+		if totalTokens == 0 {
 			continue
 		}
-		ratio := float64(selectedCount) / float64(totalCount)
-		if ratio >= s.PromotionThreshold || (totalCount == 1 && selectedCount == 1) {
+		ratio := float64(selectedTokens) / float64(totalTokens)
+		promoted := ratio >= s.PromotionThreshold
+		if promoted {
 			filesToPromote[filePath] = true
 			fmt.Printf("📂 Auto-Promoting File (Density %.0f%%): %s\n", ratio*100, filePath)
 		}
+		trace.Files[filePath] = &models.TraceFileDensity{Selected: selectedTokens, Total: totalTokens, Density: ratio, Promoted: promoted}
 	}
 
 	// 8. 构造输出结果
@@ -223,62 +293,208 @@ func (s *Selector) SelectRelevantChunks(intent string, model *llm.Model) (*Selec
 		content := utils.ReadFile(filePath)
 		if content != "" {
 			result.FullFiles[filePath] = content
+			trace.Tokens.FullFiles += model.CountTokens(content)
 		}
 	}
 
-	// 添加 Body Chunks
-	for id := range finalIDSet {
+	// 添加 Chunks: 按 Core > 宿主类型 > 保留的依赖 > 未保留的依赖 的优先级，
+	// 在 Token 预算内为每个 Chunk 选择最完整的呈现 (完整 / 省略字面量 / 折叠闭包 / 文档注释 / 签名)
+	priorities := make(map[string]int)
+	var packOrder []string
+	groups := []struct {
+		priority int
+		ids      []string
+	}{
+		{priorityCore, coreIDs},
+		{priorityHostStruct, hostStructIDs},
+		{priorityKept, append(autoKeepIDs, keptReviewIDs...)},
+		{priorityPruned, prunedIDs},
+	}
+	for _, group := range groups {
+		for _, id := range group.ids {
+			if _, assigned := priorities[id]; !assigned {
+				priorities[id] = group.priority
+				packOrder = append(packOrder, id)
+			}
+		}
+	}
+	var items []*packItem
+	for _, id := range packOrder {
 		chunk, ok := allChunksMap[id]
 		if !ok || filesToPromote[chunk.FilePath] {
 			continue
 		}
-		result.Chunks = append(result.Chunks, chunk)
+		items = append(items, newPackItem(chunk, priorities[id], model.CountTokens))
 	}
+	budget := 0
+	if s.ContextTokenBudget > 0 {
+		budget = max(s.ContextTokenBudget-trace.Tokens.FullFiles, 1)
+	}
+	packChunks(items, budget)
 
-	// 添加 Pruned Chunks (Skeleton 降级)
-	for _, id := range prunedIDs {
-		originalChunk, ok := allChunksMap[id]
-		if !ok || filesToPromote[originalChunk.FilePath] {
+	fullCount, compactedCount := 0, 0
+	for _, it := range items {
+		if it.choice < 0 {
+			trace.Tiers[it.chunk.ID] = models.TraceTierDropped
 			continue
 		}
+		result.Chunks = append(result.Chunks, it.rendered())
+		trace.Tiers[it.chunk.ID] = it.tiers[it.choice].tier.String()
+		if it.tiers[it.choice].tier == TierFull {
+			fullCount++
+			trace.Tokens.Bodies += it.tokens[it.choice]
+		} else {
+			compactedCount++
+			trace.Tokens.Compacted += it.tokens[it.choice]
+		}
+	}
 
-		// 【修复2】显式标记 Read-Only，防止 LLM 误修改
-		prunedChunk := *originalChunk
-		prunedChunk.Body = fmt.Sprintf("// [READ-ONLY REFERENCE] Signature Only\n// DO NOT MODIFY THIS CHUNK\n%s", prunedChunk.Skeleton)
-
-		result.Chunks = append(result.Chunks, &prunedChunk)
+	// 附带文件头，让生成阶段知道 lo / redisdb / openai 等指向哪个 import
+	headers := s.attachFileHeaders(result.Chunks, coreIDs, allChunksMap)
+	for _, header := range headers {
+		trace.Tokens.Compacted += model.CountTokens(header.Body)
 	}
+	result.Chunks = append(result.Chunks, headers...)
 
-	fmt.Printf("✅ Selected: %d Files, %d Body Chunks, %d Skeletons\n",
-		len(result.FullFiles), len(finalIDSet)-len(result.FullFiles), len(prunedIDs))
+	fmt.Printf("✅ Selected: %d Files, %d Body Chunks, %d Compacted Chunks\n",
+		len(result.FullFiles), fullCount, compactedCount)
 	return result, nil
 }
 
 // ensureStructDefinitions 【核心修复】防止 Method 选中但 Struct 没选中
 func (s *Selector) ensureStructDefinitions(methodIDs []string, allChunks map[string]*models.Chunk) []string {
-	var structIDs []string
+	// 宿主的 ID 规则: "dir/file.go:pkg.User.Save" -> 同目录 (同包) 下任意文件中的 "pkg.User"
+	// TS: "file.ts:Class.method" -> "file.ts:Class"
+	type hostKey struct{ dir, symbol string }
+	wanted := make(map[hostKey]bool)
 	for _, id := range methodIDs {
-		// 假设 ID 格式: "path/to/file.go:User.Save"
-		// 尝试推导: "path/to/file.go:User"
-		parts := strings.Split(id, ":")
-		if len(parts) != 2 {
+		chunk, ok := allChunks[id]
+		if !ok || chunk.Type != models.ChunkTypeMethod {
 			continue
 		}
+		path, symbol, _ := models.SplitChunkID(id)
+		if host := models.HostSymbol(symbol); host != "" {
+			wanted[hostKey{filepath.Dir(path), host}] = true
+		}
+	}
+	if len(wanted) == 0 {
+		return nil
+	}
 
-		path, name := parts[0], parts[1]
-		if strings.Contains(name, ".") {
-			structName := strings.Split(name, ".")[0]
-			potentialStructID := fmt.Sprintf("%s:%s", path, structName)
+	var structIDs []string
+	for id, chunk := range allChunks {
+		switch chunk.Type {
+		case models.ChunkTypeStruct, models.ChunkTypeInterface, models.ChunkTypeClass, models.ChunkTypeType:
+		default:
+			continue
+		}
+		path, symbol, _ := models.SplitChunkID(id)
+		if wanted[hostKey{filepath.Dir(path), symbol}] {
+			structIDs = append(structIDs, id)
+		}
+	}
+	return structIDs
+}
 
-			// 检查该 ID 是否存在且是 Struct 类型
-			if chunk, ok := allChunks[potentialStructID]; ok {
-				if chunk.Type == models.ChunkTypeStruct || chunk.Type == models.ChunkTypeInterface {
-					structIDs = append(structIDs, potentialStructID)
-				}
+// linkImplementations 接口与实现互补: 选中的接口/基类 -> 拉取实现它的类型及其方法；
+// 选中的实现类型 -> 拉取它实现的接口/基类
+func (s *Selector) linkImplementations(ids []string, allChunks map[string]*models.Chunk) (typeIDs, methodIDs []string) {
+	var implIDs []string
+	for _, id := range ids {
+		chunk, ok := allChunks[id]
+		if !ok {
+			continue
+		}
+		if chunk.Type == models.ChunkTypeInterface || chunk.Type == models.ChunkTypeClass {
+			found, err := storage.Indexer.GetImplementers(chunk.SymbolsDefined)
+			if err != nil {
+				fmt.Printf("⚠️ Error fetching implementations: %v\n", err)
+			}
+			implIDs = append(implIDs, found...)
+		}
+		if len(chunk.Implements) > 0 {
+			found, err := storage.Indexer.GetUnionLinks(chunk.Implements)
+			if err != nil {
+				fmt.Printf("⚠️ Error fetching interfaces: %v\n", err)
 			}
+			typeIDs = append(typeIDs, found...)
 		}
 	}
-	return structIDs
+
+	exists := func(id string, _ int) bool { _, ok := allChunks[id]; return ok }
+	implIDs = lo.Filter(lo.Uniq(implIDs), exists)
+	typeIDs = lo.Without(lo.Filter(lo.Uniq(append(typeIDs, implIDs...)), exists), ids...)
+	methodIDs = lo.Without(s.methodsOf(implIDs, allChunks), ids...)
+	return typeIDs, methodIDs
+}
+
+// methodsOf 返回类型的全部方法 Chunk (ensureStructDefinitions 的反向)
+func (s *Selector) methodsOf(typeIDs []string, allChunks map[string]*models.Chunk) []string {
+	type hostKey struct{ dir, symbol string }
+	wanted := make(map[hostKey]bool)
+	for _, id := range typeIDs {
+		path, symbol, _ := models.SplitChunkID(id)
+		wanted[hostKey{filepath.Dir(path), symbol}] = true
+	}
+	if len(wanted) == 0 {
+		return nil
+	}
+
+	var methodIDs []string
+	for id, chunk := range allChunks {
+		if chunk.Type != models.ChunkTypeMethod {
+			continue
+		}
+		path, symbol, _ := models.SplitChunkID(id)
+		if wanted[hostKey{filepath.Dir(path), models.HostSymbol(symbol)}] {
+			methodIDs = append(methodIDs, id)
+		}
+	}
+	sort.Strings(methodIDs)
+	return methodIDs
+}
+
+// attachFileHeaders 为已选 Chunk 所在文件生成文件头
+// 含 Core Chunk 的文件给出完整文件头 (可被修改以增删 import)；
+// 其余文件只给出 package/指令与已选 Chunk 用到的 import 行，并标记为只读
+func (s *Selector) attachFileHeaders(selected []*models.Chunk, coreIDs []string, allChunks map[string]*models.Chunk) []*models.Chunk {
+	coreFiles := make(map[string]bool)
+	for _, id := range coreIDs {
+		if c, ok := allChunks[id]; ok {
+			coreFiles[c.FilePath] = true
+		}
+	}
+
+	var files []string
+	usedImports := make(map[string][]string)
+	for _, c := range selected {
+		if _, seen := usedImports[c.FilePath]; !seen {
+			files = append(files, c.FilePath)
+			usedImports[c.FilePath] = nil
+		}
+		usedImports[c.FilePath] = append(usedImports[c.FilePath], c.Imports...)
+	}
+
+	var headers []*models.Chunk
+	for _, filePath := range files {
+		header, ok := allChunks[models.HeaderChunkID(filePath)]
+		if !ok {
+			continue
+		}
+		if coreFiles[filePath] {
+			headers = append(headers, header)
+			continue
+		}
+		lines := lo.Uniq(usedImports[filePath])
+		if len(lines) == 0 {
+			continue
+		}
+		prunedHeader := *header
+		prunedHeader.Body = fmt.Sprintf("%s Imports used by the selected chunks of this file\n// DO NOT MODIFY THIS CHUNK\n%s", ReadOnlyBanner,
+			strings.Join(lo.Compact([]string{header.Skeleton, strings.Join(lines, "\n")}), "\n\n"))
+		headers = append(headers, &prunedHeader)
+	}
+	return headers
 }
 
 func (s *Selector) runNegativeSelection(intent string, coreIDs []string, candidates []string, allChunks map[string]*models.Chunk, model *llm.Model) []string {
@@ -299,16 +515,24 @@ func (s *Selector) runNegativeSelection(intent string, coreIDs []string, candida
 		}
 	}
 
-	var keptIDs []string
-	keyedAgent := s.NegativeSelectionAgent.UseTools(llm.NewTool("KeepDependencies", "List of dependency IDs to KEEP", func(res *SelectionResult) {
-		keptIDs = res.SelectedIDs
+	// 只允许保留本轮的依赖候选
+	resolver := newIDResolver(lo.FilterMap(candidates, func(id string, _ int) (*models.Chunk, bool) {
+		c, ok := allChunks[id]
+		return c, ok
 	}))
-
-	err := keyedAgent.Call(map[string]any{
-		agent.UseModel:  model,
-		"Intent":        intent,
-		"CoreSkeleton":  coreSb.String(),
-		"DepCandidates": candSb.String(),
+	keptIDs, err := s.callResolvingIDs(resolver, func(correction string) ([]string, error) {
+		var picked []string
+		keyedAgent := s.NegativeSelectionAgent.UseTools(llm.NewTool("KeepDependencies", "List of dependency IDs to KEEP", func(res *SelectionResult) {
+			picked = res.SelectedIDs
+		}))
+		err := keyedAgent.Call(map[string]any{
+			agent.UseModel:  model,
+			"Intent":        intent,
+			"CoreSkeleton":  coreSb.String(),
+			"DepCandidates": candSb.String(),
+			"Correction":    correction,
+		})
+		return picked, err
 	})
 
 	if err != nil {
@@ -318,36 +542,76 @@ func (s *Selector) runNegativeSelection(intent string, coreIDs []string, candida
 	return keptIDs
 }
 
-func (s *Selector) expandDependencies(seeds []string, allChunks map[string]*models.Chunk) []string {
-	uniqueSeeds := lo.Uniq(seeds)
-	dependencySet := make(map[string]struct{})
-	var symbolsToQuery []string
-	seenSymbols := make(map[string]bool)
-
-	for _, id := range uniqueSeeds {
-		chunk, ok := allChunks[id]
-		if !ok {
-			continue
-		}
-		for _, sym := range chunk.SymbolsReferenced {
-			if len(sym) > 1 && !seenSymbols[sym] {
-				symbolsToQuery = append(symbolsToQuery, sym)
-				seenSymbols[sym] = true
-			}
-		}
+// expandDependencies 从 seeds 出发按引用关系广度优先扩散 ExpansionDepth 层
+// 同一跳内按引用频次 (被多少个上一跳 Chunk 引用) 降序排列；放不进剩余 Token 预算 (countTokens) 的候选被跳过，预算用尽后停止
+// 返回按 (跳数, 频次) 排好序的 ChunkID，以及每个 ChunkID 的跳数
+func (s *Selector) expandDependencies(seeds []string, allChunks map[string]*models.Chunk, countTokens func(string) int) ([]string, map[string]int) {
+	depth := max(s.ExpansionDepth, 1)
+	hops := make(map[string]int)
+	for _, id := range seeds {
+		hops[id] = 0
 	}
 
-	if len(symbolsToQuery) > 0 {
-		targetIDs, err := storage.Indexer.GetUnionLinks(symbolsToQuery)
-		if err != nil {
-			fmt.Printf("⚠️ Error fetching dependencies: %v\n", err)
-		} else {
+	var ordered []string
+	spentTokens := 0
+	frontier := lo.Uniq(seeds)
+	for hop := 1; hop <= depth && len(frontier) > 0; hop++ {
+		// 统计本跳候选的引用频次
+		frequency := make(map[string]int)
+		for _, id := range frontier {
+			chunk, ok := allChunks[id]
+			if !ok {
+				continue
+			}
+			symbols := lo.Filter(lo.Uniq(chunk.SymbolsReferenced), func(sym string, _ int) bool { return len(sym) > 1 })
+			if len(symbols) == 0 {
+				continue
+			}
+			targetIDs, err := storage.Indexer.GetUnionLinks(symbols)
+			if err != nil {
+				fmt.Printf("⚠️ Error fetching dependencies: %v\n", err)
+				continue
+			}
 			for _, tid := range targetIDs {
+				if _, visited := hops[tid]; visited {
+					continue
+				}
 				if _, exists := allChunks[tid]; exists {
-					dependencySet[tid] = struct{}{}
+					frequency[tid]++
 				}
 			}
 		}
+
+		candidates := lo.Keys(frequency)
+		sort.Slice(candidates, func(i, j int) bool {
+			if frequency[candidates[i]] != frequency[candidates[j]] {
+				return frequency[candidates[i]] > frequency[candidates[j]]
+			}
+			return candidates[i] < candidates[j]
+		})
+
+		var nextFrontier []string
+		skipped := 0
+		for _, id := range candidates {
+			if s.ExpansionTokenBudget > 0 && spentTokens >= s.ExpansionTokenBudget {
+				fmt.Printf("⚠️ Dependency expansion stopped at hop %d: token budget %d reached\n", hop, s.ExpansionTokenBudget)
+				return ordered, hops
+			}
+			tokens := countTokens(allChunks[id].Body)
+			// 超出剩余预算的候选跳过，同一跳中更小的候选仍可放入
+			if s.ExpansionTokenBudget > 0 && spentTokens+tokens > s.ExpansionTokenBudget {
+				skipped++
+				continue
+			}
+			spentTokens += tokens
+			hops[id] = hop
+			ordered = append(ordered, id)
+			nextFrontier = append(nextFrontier, id)
+		}
+		if skipped > 0 {
+			fmt.Printf("⚠️ Dependency expansion hop %d: %d candidates skipped, exceeding the remaining token budget\n", hop, skipped)
+		}
+		frontier = nextFrontier
 	}
-	return lo.Keys(dependencySet)
+	return ordered, hops
 }
@@ -0,0 +1,165 @@
+package context
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"sysevov2/models"
+	"sysevov2/storage"
+	"sysevov2/utils"
+
+	"github.com/samber/lo"
+)
+
+// newSelectionTrace 为一次选择分配 RunID: "20060102-150405-xxxx"
+func newSelectionTrace(intent string) *models.SelectionTrace {
+	now := time.Now()
+	return &models.SelectionTrace{
+		RunID:     now.Format("20060102-150405") + "-" + utils.ID(nil, 4),
+		Intent:    intent,
+		CreatedAt: now.Unix(),
+		Expanded:  make(map[string]string),
+		Verdicts:  make(map[string]string),
+		Tiers:     make(map[string]string),
+		Files:     make(map[string]*models.TraceFileDensity),
+	}
+}
+
+func saveTrace(trace *models.SelectionTrace) {
+	if _, err := storage.SelectionTraceKey.HSet(trace.RunID, trace); err != nil {
+		fmt.Printf("⚠️ Failed to save selection trace %s: %v\n", trace.RunID, err)
+		return
+	}
+	fmt.Printf("🧾 Selection trace saved: %s\n", trace.RunID)
+}
+
+// LoadTrace 按 RunID 读取选择记录
+func LoadTrace(runID string) (*models.SelectionTrace, error) {
+	trace, err := storage.SelectionTraceKey.HGet(runID)
+	if err != nil || trace == nil {
+		return nil, fmt.Errorf("selection trace not found: %s", runID)
+	}
+	return trace, nil
+}
+
+// ListTraces 返回全部选择记录，按时间倒序
+func ListTraces() ([]*models.SelectionTrace, error) {
+	all, err := storage.SelectionTraceKey.HGetAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load selection traces: %w", err)
+	}
+	traces := lo.Values(all)
+	sort.Slice(traces, func(i, j int) bool {
+		if traces[i].CreatedAt != traces[j].CreatedAt {
+			return traces[i].CreatedAt > traces[j].CreatedAt
+		}
+		return traces[i].RunID > traces[j].RunID
+	})
+	return traces, nil
+}
+
+// TraceDiff 两次选择之间的差异 (From -> To)
+type TraceDiff struct {
+	From, To string
+
+	CoreAdded, CoreRemoved         []string
+	ExpandedAdded, ExpandedRemoved []string
+	// ReasonChanged / VerdictChanged / TierChanged: ChunkID -> [From, To]，缺失一侧为空串
+	ReasonChanged  map[string][2]string
+	VerdictChanged map[string][2]string
+	TierChanged    map[string][2]string
+	// PromotedAdded / PromotedRemoved: 升格文件的变化
+	PromotedAdded, PromotedRemoved []string
+	// TokenDelta: 最终上下文估算 Token 的变化
+	TokenDelta int
+}
+
+// DiffTraces 按 RunID 比较两次选择
+func DiffTraces(fromRunID, toRunID string) (*TraceDiff, error) {
+	from, err := LoadTrace(fromRunID)
+	if err != nil {
+		return nil, err
+	}
+	to, err := LoadTrace(toRunID)
+	if err != nil {
+		return nil, err
+	}
+	return diffTraces(from, to), nil
+}
+
+func diffTraces(from, to *models.SelectionTrace) *TraceDiff {
+	diff := &TraceDiff{
+		From:           from.RunID,
+		To:             to.RunID,
+		ReasonChanged:  changedValues(from.Expanded, to.Expanded, false),
+		VerdictChanged: changedValues(from.Verdicts, to.Verdicts, true),
+		TierChanged:    changedValues(from.Tiers, to.Tiers, true),
+		TokenDelta:     to.Tokens.Total() - from.Tokens.Total(),
+	}
+	diff.CoreRemoved, diff.CoreAdded = sortedDifference(from.CoreIDs, to.CoreIDs)
+	diff.ExpandedRemoved, diff.ExpandedAdded = sortedDifference(lo.Keys(from.Expanded), lo.Keys(to.Expanded))
+	diff.PromotedRemoved, diff.PromotedAdded = sortedDifference(promotedFiles(from), promotedFiles(to))
+	return diff
+}
+
+// changedValues 比较两个 ID -> 值 的映射；includeMissing 为 false 时只比较两侧都存在的 ID
+func changedValues(from, to map[string]string, includeMissing bool) map[string][2]string {
+	changed := make(map[string][2]string)
+	for _, id := range lo.Uniq(append(lo.Keys(from), lo.Keys(to)...)) {
+		a, inFrom := from[id]
+		b, inTo := to[id]
+		if a == b || (!includeMissing && (!inFrom || !inTo)) {
+			continue
+		}
+		changed[id] = [2]string{a, b}
+	}
+	return changed
+}
+
+// sortedDifference 返回 (仅在 from 中, 仅在 to 中)，均按字典序
+func sortedDifference(from, to []string) (removed, added []string) {
+	removed, added = lo.Difference(from, to)
+	sort.Strings(removed)
+	sort.Strings(added)
+	return removed, added
+}
+
+func promotedFiles(trace *models.SelectionTrace) []string {
+	var files []string
+	for path, density := range trace.Files {
+		if density.Promoted {
+			files = append(files, path)
+		}
+	}
+	return files
+}
+
+// String 以可读形式输出差异
+func (d *TraceDiff) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Selection diff %s -> %s (tokens %+d)\n", d.From, d.To, d.TokenDelta)
+	writeIDs := func(title string, ids []string) {
+		for _, id := range ids {
+			fmt.Fprintf(&sb, "  %s %s\n", title, id)
+		}
+	}
+	writeIDs("+core", d.CoreAdded)
+	writeIDs("-core", d.CoreRemoved)
+	writeIDs("+expanded", d.ExpandedAdded)
+	writeIDs("-expanded", d.ExpandedRemoved)
+	writeChanges := func(title string, changes map[string][2]string) {
+		ids := lo.Keys(changes)
+		sort.Strings(ids)
+		for _, id := range ids {
+			fmt.Fprintf(&sb, "  ~%s %s: %q -> %q\n", title, id, changes[id][0], changes[id][1])
+		}
+	}
+	writeChanges("reason", d.ReasonChanged)
+	writeChanges("verdict", d.VerdictChanged)
+	writeChanges("tier", d.TierChanged)
+	writeIDs("+promoted", d.PromotedAdded)
+	writeIDs("-promoted", d.PromotedRemoved)
+	return sb.String()
+}
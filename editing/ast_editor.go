@@ -1,140 +1,205 @@
 package editing
 
 import (
+	"bytes"
 	"fmt"
-	"go/ast"
-	"go/parser"
-	"go/token"
-	"os"
-	"os/exec"
 	"strings"
 
+	"sysevov2/analysis"
 	"sysevov2/models"
+
+	"github.com/samber/lo"
 )
 
-// ApplyModification 执行单个代码变更
+// ApplyModification 执行单个代码变更 (格式化失败时不落盘)
 func ApplyModification(mod *models.CodeModification) error {
 	fmt.Printf("🔨 Applying edit to: %s [%s]\n", mod.FilePath, mod.ActionType)
 
-	if mod.ActionType == "CREATE_FILE" {
-		return os.WriteFile(mod.FilePath, []byte(mod.NewContent), 0644)
+	cs := NewChangeset()
+	if err := cs.Stage(mod); err != nil {
+		return err
+	}
+	return cs.Commit()
+}
+
+// modifyContent 计算修改后的文件内容，不改动传入的 content
+// deleted 表示文件 (在磁盘或暂存中) 不存在；返回的 fileDeleted 表示修改后文件被删除
+// RENAME_SYMBOL 涉及多个文件，由 Changeset.stageRename 处理
+func modifyContent(path string, content []byte, deleted bool, mod *models.CodeModification) (newContent []byte, fileDeleted bool, err error) {
+	switch mod.ActionType {
+	case models.ActionCreateFile:
+		return []byte(mod.NewContent), false, nil
+	case models.ActionModify, models.ActionDelete, models.ActionInsertBefore, models.ActionInsertAfter, models.ActionAppend:
+	default:
+		// 未知类型不再回退为追加，避免内容被悄悄写到文件末尾
+		return nil, deleted, fmt.Errorf("unsupported action type %q", mod.ActionType)
+	}
+	if deleted {
+		return nil, true, fmt.Errorf("file not found: %s", path)
 	}
 	// 处理纯删除文件的情况
-	if mod.ActionType == "DELETE" && mod.TargetChunkID == "" {
-		return os.Remove(mod.FilePath)
+	if mod.ActionType == models.ActionDelete && mod.TargetChunkID == "" {
+		return nil, true, nil
 	}
-
-	// 1. 读取源文件
-	contentBytes, err := os.ReadFile(mod.FilePath)
-	if err != nil {
-		return err
+	if mod.ActionType == models.ActionAppend {
+		return appendContent(content, mod.NewContent), false, nil
 	}
 
-	// 2. 实时解析 AST
-	fset := token.NewFileSet()
-	node, err := parser.ParseFile(fset, mod.FilePath, contentBytes, parser.ParseComments)
+	// 1. 实时解析 AST 并定位目标 Chunk
+	span, err := findChunkRange(path, content, mod.TargetChunkID)
 	if err != nil {
-		return fmt.Errorf("parse failed: %v", err)
+		return nil, false, err
+	}
+	if span.Start == -1 || span.End == -1 {
+		return nil, false, fmt.Errorf("chunk not found for %s: %s (offsets: -1, -1)", mod.ActionType, mod.TargetChunkID)
 	}
 
-	// 3. 定位目标 Chunk
-	start, end := findChunkRange(fset, node, mod.TargetChunkID)
+	// 2. 执行替换、删除或插入 (新建切片，避免 append 覆写 content 的底层数组)
+	switch mod.ActionType {
+	case models.ActionInsertBefore, models.ActionInsertAfter:
+		return insertAround(content, span, mod.NewContent, mod.ActionType == models.ActionInsertBefore), false, nil
+	}
+	newContent = make([]byte, 0, len(content)+len(mod.NewContent))
+	newContent = append(newContent, content[:span.Start]...)
+	if mod.ActionType == models.ActionModify {
+		// 分组声明中的单个 spec: 新内容若写成独立声明 ("var X = ...")，剥离关键字后再放回分组
+		replacement := mod.NewContent
+		if span.GroupKeyword != "" {
+			replacement = stripDeclKeyword(replacement, span.GroupKeyword)
+		}
+		newContent = append(newContent, replacement...)
+	}
+	return append(newContent, content[span.End:]...), false, nil
+}
 
-	// 4. 执行替换或追加
-	var newContent []byte
+// appendContent 追加到文件末尾；原文件末尾没有换行时补一个
+func appendContent(content []byte, addition string) []byte {
+	sep := "\n\n"
+	if len(content) > 0 && content[len(content)-1] != '\n' {
+		sep = "\n" + sep
+	}
+	newContent := make([]byte, 0, len(content)+len(sep)+len(addition))
+	newContent = append(newContent, content...)
+	return append(newContent, sep+addition...)
+}
 
-	// Case A: 成功定位到目标 Chunk -> 执行替换或删除
-	if start != -1 && end != -1 {
-		if mod.ActionType == "DELETE" {
-			newContent = append(contentBytes[:start], contentBytes[end:]...)
+// insertAround 在锚点 Chunk 之前或之后插入新声明
+// 锚点是分组声明 (var/const/type ( ... )) 中的 spec 时，新内容剥离关键字后作为同组的 spec 插入；
+// 在独立声明之前插入时，插入点前移到锚点的文档注释之前
+func insertAround(content []byte, span analysis.ChunkSpan, addition string, before bool) []byte {
+	addition = strings.TrimSpace(addition)
+	var at int
+	var text string
+	switch {
+	case span.GroupKeyword != "":
+		addition = stripDeclKeyword(addition, span.GroupKeyword)
+		indent := lineIndentAt(content, span.Start)
+		if before {
+			at, text = span.Start, addition+"\n"+indent
 		} else {
-			// MODIFY
-			newContent = append(contentBytes[:start], []byte(mod.NewContent)...)
-			newContent = append(newContent, contentBytes[end:]...)
+			at, text = span.End, "\n"+indent+addition
 		}
-	} else {
-		// Case B: 未定位到目标
+	case before:
+		at, text = docCommentStart(content, span.Start), addition+"\n\n"
+	default:
+		at, text = span.End, "\n\n"+addition
+	}
+	newContent := make([]byte, 0, len(content)+len(text))
+	newContent = append(newContent, content[:at]...)
+	newContent = append(newContent, text...)
+	return append(newContent, content[at:]...)
+}
 
-		// [修复核心]：如果是 MODIFY/DELETE 且找不到目标，必须报错！
-		// 只有明确是 "ADD" 或者找不到时的特定逻辑才允许追加
-		if mod.ActionType == "MODIFY" || mod.ActionType == "DELETE" {
-			return fmt.Errorf("chunk not found for %s: %s (offsets: -1, -1)", mod.ActionType, mod.TargetChunkID)
-		}
+// lineStart 返回 offset 所在行的行首偏移
+func lineStart(content []byte, offset int) int {
+	return bytes.LastIndexByte(content[:offset], '\n') + 1
+}
 
-		// 只有在非 MODIFY 情况下（例如明确的 ADD 指令），才执行追加作为回退
-		// 追加模式 (Fallback)
-		// 注意：如果原文件末尾没有换行，最好补一个
-		sep := "\n\n"
-		if len(contentBytes) > 0 && contentBytes[len(contentBytes)-1] != '\n' {
-			sep = "\n" + sep
+// lineIndentAt 返回 offset 所在行的前导空白
+func lineIndentAt(content []byte, offset int) string {
+	start := lineStart(content, offset)
+	end := start
+	for end < offset && (content[end] == ' ' || content[end] == '\t') {
+		end++
+	}
+	return string(content[start:end])
+}
+
+// docCommentStart 从声明所在行向上越过紧邻的注释行 (// 、/* */ 与 JSDoc)，返回注释块的行首偏移
+func docCommentStart(content []byte, declStart int) int {
+	start := lineStart(content, declStart)
+	for start > 0 {
+		prev := lineStart(content, start-1)
+		line := strings.TrimSpace(string(content[prev : start-1]))
+		if !strings.HasPrefix(line, "//") && !strings.HasPrefix(line, "/*") && !strings.HasPrefix(line, "*") {
+			break
 		}
-		newContent = append(contentBytes, []byte(sep+mod.NewContent)...)
+		start = prev
 	}
+	return start
+}
 
-	// 5. 写回文件
-	if err := os.WriteFile(mod.FilePath, newContent, 0644); err != nil {
-		return err
+// findChunkRange 辅助函数：在 AST 中定位 ID
+// ID 规则与索引一致 (见 models.ChunkIDAllocator)，由 analysis.LocateChunks 按语言实时计算
+// 未找到时返回 Start/End 为 -1 的区间
+func findChunkRange(path string, content []byte, chunkID string) (analysis.ChunkSpan, error) {
+	notFound := analysis.ChunkSpan{ID: chunkID, Start: -1, End: -1}
+	spans, err := analysis.LocateChunks(path, content)
+	if err != nil {
+		return notFound, fmt.Errorf("parse failed: %v", err)
 	}
 
-	// 6. 自动修复 Imports (Goimports)
-	if strings.HasSuffix(mod.FilePath, ".go") {
-		exec.Command("goimports", "-w", mod.FilePath).Run()
+	// [修复]：增加 TrimSpace，防止 "extractGoDefinitions " 这种带尾随空格的情况导致不匹配
+	chunkID = strings.TrimSpace(chunkID)
+	for _, span := range spans {
+		if span.ID == chunkID {
+			return span, nil
+		}
 	}
 
-	return nil
+	// 路径写法不一致 (相对/绝对路径)，或沿用旧格式省略了包名 ("User.Save")，按符号 + 序号匹配
+	// 匹配到多个声明时 (如 TS 不同类的同名方法) 报错，不猜测
+	_, targetSymbol, targetOrdinal := models.SplitChunkID(chunkID)
+	var matches []analysis.ChunkSpan
+	for _, span := range spans {
+		_, symbol, ordinal := models.SplitChunkID(span.ID)
+		if ordinal != targetOrdinal {
+			continue
+		}
+		_, shortSymbol, _ := strings.Cut(symbol, ".")
+		if symbol == targetSymbol || shortSymbol == targetSymbol {
+			matches = append(matches, span)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return notFound, nil
+	case 1:
+		return matches[0], nil
+	}
+	ids := lo.Map(matches, func(span analysis.ChunkSpan, _ int) string { return span.ID })
+	return notFound, fmt.Errorf("ambiguous chunk ID %s, matches %s", chunkID, strings.Join(ids, ", "))
 }
 
-// findChunkRange 辅助函数：在 AST 中定位 ID
-func findChunkRange(fset *token.FileSet, node *ast.File, chunkID string) (int, int) {
-	// 从 chunkID "main.go:User.Save" 提取 "User.Save"
-	parts := strings.Split(chunkID, ":")
-	// [修复]：增加 TrimSpace，防止 "extractGoDefinitions " 这种带尾随空格的情况导致不匹配
-	targetName := strings.TrimSpace(parts[len(parts)-1])
-
-	var start, end = -1, -1
-
-	ast.Inspect(node, func(n ast.Node) bool {
-		if start != -1 {
-			return false
-		} // 已找到
-
-		switch x := n.(type) {
-		case *ast.FuncDecl:
-			// 拼接 Receiver 名字
-			name := x.Name.Name
-			if x.Recv != nil && len(x.Recv.List) > 0 {
-				recvType := ""
-				// ... (原有 receiver 处理逻辑保持不变) ...
-				if star, ok := x.Recv.List[0].Type.(*ast.StarExpr); ok {
-					if id, ok := star.X.(*ast.Ident); ok {
-						recvType = id.Name
-					}
-				} else if id, ok := x.Recv.List[0].Type.(*ast.Ident); ok {
-					recvType = id.Name
-				}
-				if recvType != "" {
-					name = recvType + "." + name
-				}
-			}
-
-			// [建议]：如果你的 ID 系统可能包含包名 (如 analysis.extractGoSymbols)，
-			// 你可以在这里加一个逻辑：如果 targetName 包含点但没匹配上，尝试仅匹配函数名部分。
-			if name == targetName {
-				start = fset.Position(x.Pos()).Offset
-				end = fset.Position(x.End()).Offset
-			}
-		// ... (GenDecl 逻辑保持不变) ...
-		case *ast.GenDecl:
-			if x.Tok == token.TYPE && len(x.Specs) > 0 {
-				if ts, ok := x.Specs[0].(*ast.TypeSpec); ok {
-					if ts.Name.Name == targetName {
-						start = fset.Position(x.Pos()).Offset
-						end = fset.Position(x.End()).Offset
-					}
-				}
-			}
+// stripDeclKeyword 剥离新内容中 (跳过前导注释后) 的声明关键字: "var X = 1" -> "X = 1"
+// 若新内容本身是一个分组 ("var ( ... )")，保持原样
+func stripDeclKeyword(content, keyword string) string {
+	lines := strings.Split(content, "\n")
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "//") {
+			continue
+		}
+		rest, ok := strings.CutPrefix(trimmed, keyword)
+		if !ok || rest == "" || (rest[0] != ' ' && rest[0] != '\t') {
+			return content
 		}
-		return true
-	})
-	return start, end
+		rest = strings.TrimLeft(rest, " \t")
+		if strings.HasPrefix(rest, "(") {
+			return content
+		}
+		lines[i] = rest
+		return strings.Join(lines, "\n")
+	}
+	return content
 }
@@ -0,0 +1,109 @@
+package editing
+
+import (
+	"strings"
+	"testing"
+
+	"sysevov2/analysis"
+	"sysevov2/models"
+)
+
+const anchorSource = `package lib
+
+import "fmt"
+
+// Hello greets
+// in two lines
+func Hello() { fmt.Println("hello") }
+
+func World() {}
+
+var (
+	// A first
+	A = 1
+	B = 2
+)
+`
+
+func TestInsertAround(t *testing.T) {
+	path := "/src/lib/lib.go"
+	tests := []struct {
+		name   string
+		action string
+		symbol string
+		add    string
+		want   string
+	}{
+		{"before goes above the doc comment", models.ActionInsertBefore, "lib.Hello", "func Pre() {}",
+			"import \"fmt\"\n\nfunc Pre() {}\n\n// Hello greets\n// in two lines\nfunc Hello()"},
+		{"after follows the declaration", models.ActionInsertAfter, "lib.Hello", "func Post() {}",
+			"fmt.Println(\"hello\") }\n\nfunc Post() {}\n\nfunc World() {}"},
+		{"before without doc comment", models.ActionInsertBefore, "lib.World", "// Pre doc\nfunc Pre() {}",
+			"fmt.Println(\"hello\") }\n\n// Pre doc\nfunc Pre() {}\n\nfunc World() {}"},
+		{"grouped spec keeps the group", models.ActionInsertBefore, "lib.A", "var Z = 0",
+			"var (\n\tZ = 0\n\t// A first\n\tA = 1"},
+		{"after a grouped spec", models.ActionInsertAfter, "lib.B", "var C = 3",
+			"\tB = 2\n\tC = 3\n)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mod := &models.CodeModification{ActionType: tt.action, FilePath: path, TargetChunkID: models.BuildChunkID(path, tt.symbol), NewContent: tt.add}
+			got, deleted, err := modifyContent(path, []byte(anchorSource), false, mod)
+			if err != nil || deleted {
+				t.Fatalf("modifyContent: deleted=%v err=%v", deleted, err)
+			}
+			if !strings.Contains(string(got), tt.want) {
+				t.Errorf("result does not contain %q:\n%s", tt.want, got)
+			}
+			if _, err := analysis.LocateGoChunks(path, got); err != nil {
+				t.Errorf("result does not parse: %v\n%s", err, got)
+			}
+		})
+	}
+}
+
+func TestFindChunkRange(t *testing.T) {
+	path := "/src/lib/lib.go"
+	content := []byte(anchorSource)
+	tests := []struct {
+		id       string
+		wantText string // 为空表示未找到
+	}{
+		{models.BuildChunkID(path, "lib.World"), "func World() {}"},
+		// 路径写法不一致时按符号匹配，包名可省略
+		{models.BuildChunkID("lib/lib.go", "lib.World"), "func World() {}"},
+		{models.BuildChunkID(path, "World"), "func World() {}"},
+		{models.BuildChunkID(path, "lib.Missing"), ""},
+	}
+	for _, tt := range tests {
+		span, err := findChunkRange(path, content, tt.id)
+		if err != nil {
+			t.Errorf("findChunkRange(%s): %v", tt.id, err)
+			continue
+		}
+		got := ""
+		if span.Start >= 0 {
+			got = string(content[span.Start:span.End])
+		}
+		if got != tt.wantText {
+			t.Errorf("findChunkRange(%s) = %q, want %q", tt.id, got, tt.wantText)
+		}
+	}
+}
+
+// TestFindChunkRangeAmbiguous 不同类的同名方法按省略类名的 ID 查找时报错，需要 TS sidecar
+func TestFindChunkRangeAmbiguous(t *testing.T) {
+	path := "/src/app/store.ts"
+	content := []byte("export class A {\n  save() {}\n}\n\nexport class B {\n  save() {}\n}\n")
+	if _, err := analysis.LocateTSChunks(path, content); err != nil {
+		t.Skipf("TS sidecar unavailable: %v", err)
+	}
+	_, err := findChunkRange(path, content, models.BuildChunkID("app/store.ts", "save"))
+	if err == nil || !strings.Contains(err.Error(), "ambiguous chunk ID") {
+		t.Errorf("findChunkRange = %v, want ambiguous chunk ID error", err)
+	}
+	span, err := findChunkRange(path, content, models.BuildChunkID("app/store.ts", "B.save"))
+	if err != nil || span.Start < 0 || !strings.Contains(string(content[:span.Start]), "class B") {
+		t.Errorf("findChunkRange(B.save) = %+v, %v", span, err)
+	}
+}
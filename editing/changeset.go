@@ -0,0 +1,330 @@
+package editing
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"sysevov2/analysis"
+	"sysevov2/models"
+
+	"github.com/samber/lo"
+	"golang.org/x/tools/imports"
+)
+
+// stagedFile 文件在变更集中的暂存状态
+type stagedFile struct {
+	path     string
+	original []byte // 磁盘上的原始内容
+	existed  bool
+	mode     os.FileMode
+	content  []byte
+	deleted  bool
+	dirty    bool  // 暂存后尚未格式化
+	mods     []int // 触及该文件的修改下标 (按 Stage 顺序)
+}
+
+func (f *stagedFile) changed() bool {
+	if f.deleted || !f.existed {
+		return f.deleted == f.existed
+	}
+	return !bytes.Equal(f.content, f.original)
+}
+
+// FileError 某个文件在格式化或落盘时的错误
+type FileError struct {
+	Path string
+	Err  error
+}
+
+func (e *FileError) Error() string { return fmt.Sprintf("%s: %v", e.Path, e.Err) }
+func (e *FileError) Unwrap() error { return e.Err }
+
+// Changeset 在内存中暂存一组修改，全部校验通过后整体落盘
+// 同一文件的多个修改依次叠加在暂存内容上，后一个修改看到的是前一个修改的结果
+type Changeset struct {
+	files     map[string]*stagedFile
+	paths     []string // 首次触及的顺序
+	staged    int      // 已尝试暂存的修改数，即下一个修改的下标
+	committed bool
+}
+
+func NewChangeset() *Changeset {
+	return &Changeset{files: make(map[string]*stagedFile)}
+}
+
+// file 返回暂存中的文件，首次访问时从磁盘加载
+// 以绝对路径为键，同一文件的相对/绝对写法 (如修改的 FilePath 与索引中的 FilePath) 共享暂存内容
+func (cs *Changeset) file(path string) (*stagedFile, error) {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	if f, ok := cs.files[path]; ok {
+		return f, nil
+	}
+	f := &stagedFile{path: path, mode: 0644}
+	content, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		f.original, f.content, f.existed = content, content, true
+		if info, statErr := os.Stat(path); statErr == nil {
+			f.mode = info.Mode().Perm()
+		}
+	case os.IsNotExist(err):
+		f.deleted = true
+	default:
+		return nil, err
+	}
+	cs.files[path] = f
+	cs.paths = append(cs.paths, path)
+	return f, nil
+}
+
+// Paths 返回内容有变动的文件 (含新建与删除)，按首次修改的顺序
+func (cs *Changeset) Paths() []string {
+	return lo.Filter(cs.paths, func(path string, _ int) bool { return cs.files[path].changed() })
+}
+
+// Stage 将修改应用到暂存内容；失败时暂存内容保持不变
+func (cs *Changeset) Stage(mod *models.CodeModification) error {
+	index := cs.staged
+	cs.staged++
+
+	if mod.ActionType == models.ActionRenameSymbol {
+		return cs.stageRename(mod, index)
+	}
+	f, err := cs.file(mod.FilePath)
+	if err != nil {
+		return err
+	}
+	content, deleted, err := modifyContent(f.path, f.content, f.deleted, mod)
+	if err != nil {
+		return err
+	}
+	f.content, f.deleted, f.dirty = content, deleted, !deleted
+	f.mods = append(f.mods, index)
+	return nil
+}
+
+// Format 校验并格式化每个暂存后有变动的文件，返回失败的文件:
+// Go 文件解析、整理 imports 并格式化；TS/JS 文件交给 sidecar 做语法检查 (内容原样保留)
+// sidecar 不可用时跳过 TS/JS 检查并告警，其余语言原样保留
+func (cs *Changeset) Format() []*FileError {
+	var errs []*FileError
+	for _, path := range cs.paths {
+		f := cs.files[path]
+		if !f.dirty {
+			continue
+		}
+		switch {
+		case strings.HasSuffix(path, ".go"):
+			formatted, err := imports.Process(path, f.content, nil)
+			if err != nil {
+				errs = append(errs, &FileError{Path: path, Err: err})
+				continue
+			}
+			f.content = formatted
+		case isTSOrJS(path):
+			diagnostics, err := analysis.CheckTSSyntax(path, f.content)
+			if err != nil {
+				fmt.Printf("⚠️ TS syntax check unavailable, skipping %s: %v\n", path, err)
+				break
+			}
+			if len(diagnostics) > 0 {
+				messages := lo.Map(diagnostics, func(d analysis.TSDiagnostic, _ int) string { return d.String() })
+				errs = append(errs, &FileError{Path: path, Err: fmt.Errorf("syntax errors:\n%s", strings.Join(messages, "\n"))})
+				continue
+			}
+		}
+		f.dirty = false
+	}
+	return errs
+}
+
+// isTSOrJS 判断是否为 sidecar 可解析的 TS/JS 源文件
+func isTSOrJS(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".ts", ".tsx", ".mts", ".cts", ".js", ".jsx", ".mjs", ".cjs":
+		return true
+	}
+	return false
+}
+
+// Commit 将暂存内容写回磁盘: 先把每个文件写入同目录的临时文件，全部成功后再逐个 rename 替换
+// 任一步失败时恢复已替换的文件、清理临时文件，磁盘保持提交前的状态
+func (cs *Changeset) Commit() error {
+	if errs := cs.Format(); len(errs) > 0 {
+		return errs[0]
+	}
+
+	type pendingWrite struct {
+		f   *stagedFile
+		tmp string // 删除文件时为空
+	}
+	var writes []pendingWrite
+	removeTemps := func(ws []pendingWrite) {
+		for _, w := range ws {
+			if w.tmp != "" {
+				os.Remove(w.tmp)
+			}
+		}
+	}
+	for _, path := range cs.paths {
+		f := cs.files[path]
+		if !f.changed() {
+			continue
+		}
+		if f.deleted {
+			writes = append(writes, pendingWrite{f: f})
+			continue
+		}
+		tmp, err := writeTemp(path, f.content, f.mode)
+		if err != nil {
+			removeTemps(writes)
+			return &FileError{Path: path, Err: err}
+		}
+		writes = append(writes, pendingWrite{f: f, tmp: tmp})
+	}
+
+	for i, w := range writes {
+		var err error
+		if w.tmp == "" {
+			err = os.Remove(w.f.path)
+		} else {
+			err = os.Rename(w.tmp, w.f.path)
+		}
+		if err != nil {
+			for _, done := range writes[:i] {
+				if restoreErr := restoreFile(done.f); restoreErr != nil {
+					fmt.Printf("⚠️ Failed to restore %s: %v\n", done.f.path, restoreErr)
+				}
+			}
+			removeTemps(writes[i:])
+			return &FileError{Path: w.f.path, Err: err}
+		}
+	}
+	cs.committed = true
+	return nil
+}
+
+// Rollback 撤销已提交的变更，恢复每个文件提交前的内容 (新建的文件被删除)
+// 未提交时磁盘未被改动，直接返回
+func (cs *Changeset) Rollback() error {
+	if !cs.committed {
+		return nil
+	}
+	var failed []string
+	for _, path := range cs.paths {
+		f := cs.files[path]
+		if !f.changed() {
+			continue
+		}
+		if err := restoreFile(f); err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", path, err))
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("rollback incomplete: %s", strings.Join(failed, "; "))
+	}
+	cs.committed = false
+	return nil
+}
+
+// restoreFile 将文件恢复为暂存前的磁盘状态
+func restoreFile(f *stagedFile) error {
+	if !f.existed {
+		if err := os.Remove(f.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	tmp, err := writeTemp(f.path, f.original, f.mode)
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, f.path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// writeTemp 在目标文件所在目录写入临时文件 (保证 rename 不跨文件系统)，返回临时文件路径
+func writeTemp(path string, content []byte, mode os.FileMode) (string, error) {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".evo-*")
+	if err != nil {
+		return "", err
+	}
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	if err := os.Chmod(tmp.Name(), mode); err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	return tmp.Name(), nil
+}
+
+// StageSolution 暂存并格式化方案中的全部修改，失败的修改记录到 sol.Errors
+// 任一修改失败时 sol.Status 置为 FAILED 并返回错误；成功时返回待提交的变更集
+func StageSolution(sol *models.Solution) (*Changeset, error) {
+	sol.Status, sol.Errors = models.SolutionPending, nil
+
+	cs := NewChangeset()
+	for i, mod := range sol.Modifications {
+		if err := cs.Stage(mod); err != nil {
+			sol.AddError(i, err)
+		}
+	}
+	// 格式化失败 (通常是语法错误) 归咎于触及该文件的全部修改
+	for _, fe := range cs.Format() {
+		for _, i := range cs.files[fe.Path].mods {
+			sol.AddError(i, fe.Err)
+		}
+	}
+	if len(sol.Errors) > 0 {
+		sol.Status = models.SolutionFailed
+		return nil, fmt.Errorf("%d of %d modifications failed, nothing written", len(sol.Errors), len(sol.Modifications))
+	}
+	return cs, nil
+}
+
+// ApplySolution 将方案作为整体应用: 全部修改暂存、格式化成功后原子落盘，否则不改动任何文件
+func ApplySolution(sol *models.Solution) (*Changeset, error) {
+	cs, err := StageSolution(sol)
+	if err != nil {
+		return nil, err
+	}
+	if err := CommitSolution(sol, cs); err != nil {
+		return nil, err
+	}
+	return cs, nil
+}
+
+// CommitSolution 原子落盘 StageSolution 返回的变更集；失败时错误记到触及该文件的修改，磁盘保持不变
+// 调用方可在暂存与落盘之间检查 cs.Paths() 上的现状 (如记录编译基线)
+func CommitSolution(sol *models.Solution, cs *Changeset) error {
+	if err := cs.Commit(); err != nil {
+		if fe, ok := err.(*FileError); ok && cs.files[fe.Path] != nil {
+			for _, i := range cs.files[fe.Path].mods {
+				sol.AddError(i, fe.Err)
+			}
+		}
+		sol.Status = models.SolutionFailed
+		return fmt.Errorf("failed to write solution, nothing written: %w", err)
+	}
+	sol.Status = models.SolutionApplied
+	return nil
+}
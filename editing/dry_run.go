@@ -0,0 +1,115 @@
+package editing
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"sysevov2/config"
+	"sysevov2/models"
+	"sysevov2/utils"
+)
+
+// FileDiff 单个文件的统一差异
+type FileDiff struct {
+	Path string
+	Diff string
+}
+
+// Patch 一组文件差异，可直接用 git apply / patch -p1 应用
+type Patch []FileDiff
+
+func (p Patch) String() string {
+	var sb strings.Builder
+	for _, d := range p {
+		sb.WriteString(d.Diff)
+	}
+	return sb.String()
+}
+
+// Save 将每个文件的差异追加到所属 Realm 的 .evo/GitDiffs-<file>.toml 历史；不属于任何 Realm 的文件跳过
+func (p Patch) Save() error {
+	for _, d := range p {
+		realm, rel := realmRelative(d.Path)
+		if realm == nil {
+			fmt.Printf("⚠️ %s is outside every realm, patch not saved\n", d.Path)
+			continue
+		}
+		if err := utils.AppendGitDiff(realm.EvoFile(config.EvoUnifiedDiffFormat, realm.RootPath+"/"+rel), d.Diff); err != nil {
+			return fmt.Errorf("failed to save patch for %s: %w", d.Path, err)
+		}
+	}
+	return nil
+}
+
+// Diffs 返回暂存内容相对磁盘原始内容的差异，按文件首次被修改的顺序；未变动的文件不出现
+func (cs *Changeset) Diffs() Patch {
+	var patch Patch
+	for _, path := range cs.paths {
+		f := cs.files[path]
+		if !f.changed() {
+			continue
+		}
+		name := diffName(path)
+		oldName, newName := "a/"+name, "b/"+name
+		oldContent, newContent := string(f.original), string(f.content)
+		if !f.existed {
+			oldName, oldContent = "/dev/null", ""
+		}
+		if f.deleted {
+			newName, newContent = "/dev/null", ""
+		}
+		patch = append(patch, FileDiff{Path: path, Diff: utils.UnifiedDiff(oldName, newName, oldContent, newContent)})
+	}
+	return patch
+}
+
+// DryRunModification 计算单个修改 (含格式化) 后的差异，不写磁盘
+func DryRunModification(mod *models.CodeModification) (Patch, error) {
+	cs := NewChangeset()
+	if err := cs.Stage(mod); err != nil {
+		return nil, err
+	}
+	if errs := cs.Format(); len(errs) > 0 {
+		return nil, errs[0]
+	}
+	return cs.Diffs(), nil
+}
+
+// DryRunSolution 暂存并格式化整个方案，返回差异而不写磁盘；sol.Status 保持 PENDING，失败时同 StageSolution
+func DryRunSolution(sol *models.Solution) (Patch, error) {
+	cs, err := StageSolution(sol)
+	if err != nil {
+		return nil, err
+	}
+	return cs.Diffs(), nil
+}
+
+// realmRelative 返回文件所属的 Realm 及相对其根目录的路径
+func realmRelative(path string) (*config.EvoRealm, string) {
+	realm := config.RealmOf(path)
+	if realm == nil {
+		return nil, ""
+	}
+	root, err := filepath.Abs(realm.RootPath)
+	if err != nil {
+		return nil, ""
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, ""
+	}
+	rel, err := filepath.Rel(root, abs)
+	if err != nil {
+		return nil, ""
+	}
+	return realm, filepath.ToSlash(rel)
+}
+
+// diffName 差异头中的文件名: Realm 内的文件用相对路径，其余保持原样
+func diffName(path string) string {
+	if _, rel := realmRelative(path); rel != "" {
+		return rel
+	}
+	return strings.TrimPrefix(filepath.ToSlash(path), "/")
+}
@@ -0,0 +1,518 @@
+package editing
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"sysevov2/analysis"
+	"sysevov2/models"
+	"sysevov2/storage"
+
+	"github.com/samber/lo"
+	"golang.org/x/tools/go/packages"
+)
+
+var tsIdentifier = regexp.MustCompile(`^[A-Za-z_$][A-Za-z0-9_$]*$`)
+
+// renameTarget 被改名的符号
+type renameTarget struct {
+	oldName, newName string
+	// member 为 true 表示方法 (Go "pkg.Recv.Method" / TS "Class.method")
+	member bool
+	// class TS 方法所属的类名，静态方法在类内以 "Class.method" 自引用
+	class string
+}
+
+// stageRename RENAME_SYMBOL: 将目标 Chunk 定义的符号改名为 NewContent，并更新引用处
+// Go 用 go/types 解析所属模块 (含测试)，只改写与目标为同一 types.Object 的标识符；
+// TS 没有类型信息，顶层符号通过符号索引 (sys/idx/ref) 找到引用方，成员只在没有类外引用时改名
+// 注释只在定义处 (含文档注释) 改写；所有文件的新内容计算成功后才写入暂存，任一处失败时暂存内容保持不变
+// 接口方法的其他实现不会被一并改名，遗漏由编译校验发现
+func (cs *Changeset) stageRename(mod *models.CodeModification, index int) error {
+	f, err := cs.file(mod.FilePath)
+	if err != nil {
+		return err
+	}
+	if f.deleted {
+		return fmt.Errorf("file not found: %s", mod.FilePath)
+	}
+	span, err := findChunkRange(f.path, f.content, mod.TargetChunkID)
+	if err != nil {
+		return err
+	}
+	if span.Start < 0 {
+		return fmt.Errorf("chunk not found for %s: %s", mod.ActionType, mod.TargetChunkID)
+	}
+
+	isGo := filepath.Ext(f.path) == ".go"
+	target := renameTarget{newName: strings.TrimSpace(mod.NewContent)}
+	if (isGo && !token.IsIdentifier(target.newName)) || (!isGo && !tsIdentifier.MatchString(target.newName)) {
+		return fmt.Errorf("invalid new name %q for %s", target.newName, mod.ActionType)
+	}
+	_, symbol, _ := models.SplitChunkID(span.ID)
+	parts := strings.Split(symbol, ".")
+	target.oldName = parts[len(parts)-1]
+	if isGo {
+		target.member = len(parts) == 3
+	} else {
+		target.member = len(parts) == 2
+		if target.member {
+			target.class = parts[0]
+		}
+	}
+	if symbol == models.HeaderSymbol || target.oldName == target.newName {
+		return fmt.Errorf("nothing to rename in %s", mod.TargetChunkID)
+	}
+
+	definition := string(f.content[span.Start:span.End])
+	decl, err := target.declaration(f.path, f.content, span, definition)
+	if err != nil {
+		return err
+	}
+	var pending map[*stagedFile][]byte
+	if isGo {
+		pending, err = cs.renameGo(f, span, decl, target)
+	} else {
+		pending, err = cs.renameTS(f, span, decl, target, mod.TargetChunkID)
+	}
+	if err != nil {
+		return err
+	}
+
+	for sf, content := range pending {
+		sf.content, sf.dirty = content, true
+		if !lo.Contains(sf.mods, index) {
+			sf.mods = append(sf.mods, index)
+		}
+	}
+	fmt.Printf("✏️ Renamed %s -> %s, updated %d files\n", target.oldName, target.newName, len(pending))
+	return nil
+}
+
+// renameGo 通过 go/types 找到与声明为同一对象的全部标识符 (定义、自引用与其他包中的引用) 并改名
+// 以暂存内容作为 overlay 加载定义所在模块的全部包 (含测试变体)；模块存在类型错误时
+// 引用无法完整解析，拒绝改名；其他模块中的引用不在处理范围内
+func (cs *Changeset) renameGo(f *stagedFile, span analysis.ChunkSpan, decl renameDecl, target renameTarget) (map[*stagedFile][]byte, error) {
+	root := GoModuleRoot(f.path)
+	if root == "" {
+		return nil, fmt.Errorf("no go.mod found above %s, references to %s cannot be resolved", f.path, target.oldName)
+	}
+	overlay := make(map[string][]byte)
+	for path, sf := range cs.files {
+		if filepath.Ext(path) == ".go" && !sf.deleted && sf.changed() {
+			overlay[path] = sf.content
+		}
+	}
+	cfg := &packages.Config{
+		Mode: packages.NeedName | packages.NeedFiles | packages.NeedSyntax | packages.NeedImports |
+			packages.NeedDeps | packages.NeedTypes | packages.NeedTypesInfo,
+		Dir:     root,
+		Fset:    token.NewFileSet(),
+		Tests:   true,
+		Overlay: overlay,
+	}
+	pkgs, err := packages.Load(cfg, "./...")
+	if err != nil {
+		return nil, fmt.Errorf("load packages in %s: %w", root, err)
+	}
+	for _, pkg := range pkgs {
+		if len(pkg.Errors) > 0 {
+			return nil, fmt.Errorf("package %s has errors, references to %s cannot be resolved, rename aborted: %v", pkg.PkgPath, target.oldName, pkg.Errors[0])
+		}
+	}
+
+	// 测试变体中同一声明是不同的 types.Object，按声明位置判定是否为目标
+	declOffset := span.Start + decl.offset
+	isTarget := func(obj types.Object) bool {
+		if obj == nil || !obj.Pos().IsValid() || obj.Name() != target.oldName {
+			return false
+		}
+		pos := cfg.Fset.PositionFor(obj.Pos(), false)
+		return pos.Offset == declOffset && filepath.Clean(pos.Filename) == f.path
+	}
+	// edits: 文件 -> 需要改名的标识符偏移
+	edits := make(map[string]map[int]bool)
+	found := false
+	for _, pkg := range pkgs {
+		// 跳过 go test 生成的测试主包
+		if pkg.TypesInfo == nil || strings.HasSuffix(pkg.ID, ".test") {
+			continue
+		}
+		for _, idents := range []map[*ast.Ident]types.Object{pkg.TypesInfo.Defs, pkg.TypesInfo.Uses} {
+			for ident, obj := range idents {
+				if !isTarget(obj) {
+					continue
+				}
+				pos := cfg.Fset.PositionFor(ident.Pos(), false)
+				path := filepath.Clean(pos.Filename)
+				if !underDir(path, root) || filepath.Ext(path) != ".go" {
+					return nil, fmt.Errorf("reference to %s in generated file %s cannot be rewritten, rename aborted", target.oldName, path)
+				}
+				if edits[path] == nil {
+					edits[path] = make(map[int]bool)
+				}
+				edits[path][pos.Offset] = true
+				found = found || (path == f.path && pos.Offset == declOffset)
+			}
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("declaration of %s not found by the type checker, rename aborted", target.oldName)
+	}
+
+	defStart := docCommentStart(f.content, span.Start)
+	pending := make(map[*stagedFile][]byte)
+	for path, offsets := range edits {
+		sf, err := cs.file(path)
+		if err != nil {
+			return nil, fmt.Errorf("referrer file unavailable, rename aborted: %s", path)
+		}
+		if sf.deleted {
+			continue // 已暂存删除的文件不再需要改写
+		}
+		var replacements []replacement
+		for offset := range offsets {
+			if sf == f && offset >= defStart && offset < span.End {
+				continue
+			}
+			if offset > len(sf.content) || !bytes.HasPrefix(sf.content[offset:], []byte(target.oldName)) {
+				return nil, fmt.Errorf("reference to %s at %s:%d does not match the staged content, rename aborted", target.oldName, path, offset)
+			}
+			replacements = append(replacements, replacement{offset, offset + len(target.oldName), target.newName})
+		}
+		if sf == f {
+			// 定义处连同文档注释与其中的注释一起改写
+			text, _ := replaceIdent(string(f.content[defStart:span.End]), target.oldName, target.newName, true, func(_ string, i int) bool {
+				return offsets[defStart+i]
+			})
+			replacements = append(replacements, replacement{defStart, span.End, text})
+		}
+		pending[sf] = applyReplacements(sf.content, replacements)
+	}
+	return pending, nil
+}
+
+// renameTS 通过符号索引改名 TS 符号
+// 索引只按名称建立引用关系，无法区分不同类的同名成员: 成员在类外有引用方时拒绝改名，
+// 类内的其他方法只改写 "this.name" / "Class.name"；顶层符号改写引用方中不带限定的出现
+func (cs *Changeset) renameTS(f *stagedFile, span analysis.ChunkSpan, decl renameDecl, target renameTarget, targetID string) (map[*stagedFile][]byte, error) {
+	// pending: 本次改名涉及的文件 -> 新内容
+	pending := map[*stagedFile][]byte{}
+	contentOf := func(f *stagedFile) []byte {
+		if content, ok := pending[f]; ok {
+			return content
+		}
+		return f.content
+	}
+
+	// 1. 定义处 (含文档注释): 只替换声明名本身与自引用，方法体内其他对象的同名成员保持不变
+	defStart := docCommentStart(f.content, span.Start)
+	renamed, _ := replaceIdent(string(f.content[defStart:span.End]), target.oldName, target.newName, true, func(src string, i int) bool {
+		return i == span.Start-defStart+decl.offset || target.acceptSelfReference(src, i, decl.receivers)
+	})
+	pending[f] = splice(f.content, defStart, span.End, renamed)
+
+	// 2. 引用方: 任一引用方无法定位或无法确认时整体失败，不做部分改名
+	referrers, err := referrers(targetID, span.ID)
+	if err != nil {
+		return nil, err
+	}
+	if target.member {
+		foreign := lo.Filter(referrers, func(ref *models.Chunk, _ int) bool {
+			_, symbol, _ := models.SplitChunkID(ref.ID)
+			return filepath.Clean(ref.FilePath) != f.path || !strings.HasPrefix(symbol, target.class+".")
+		})
+		if len(foreign) > 0 {
+			ids := lo.Map(foreign, func(ref *models.Chunk, _ int) string { return ref.ID })
+			return nil, fmt.Errorf("%s.%s is referenced by name only from %s; without receiver types these cannot be told apart from other %s members, rename aborted",
+				target.class, target.oldName, strings.Join(ids, ", "), target.oldName)
+		}
+	}
+	for _, ref := range referrers {
+		rf, err := cs.file(ref.FilePath)
+		if err != nil || rf.deleted {
+			return nil, fmt.Errorf("referrer file unavailable, rename aborted: %s", ref.FilePath)
+		}
+		ids := []string{ref.ID}
+		// 从其他模块引用顶层符号时，import { Name } 位于文件头
+		if !target.member && rf != f {
+			ids = append(ids, models.HeaderChunkID(ref.FilePath))
+		}
+		accept := target.acceptReference
+		if target.member {
+			accept = func(src string, i int) bool { return target.acceptSelfReference(src, i, decl.receivers) }
+		}
+		for _, id := range ids {
+			content := contentOf(rf)
+			refSpan, err := findChunkRange(rf.path, content, id)
+			if err == nil && refSpan.Start < 0 {
+				err = fmt.Errorf("chunk not found")
+			}
+			if err != nil {
+				if id != ref.ID {
+					continue // 文件头可能不存在 (无 import)
+				}
+				return nil, fmt.Errorf("referrer %s cannot be located (index may be stale, re-index and retry), rename aborted: %v", id, err)
+			}
+			text, n := replaceIdent(string(content[refSpan.Start:refSpan.End]), target.oldName, target.newName, false, accept)
+			if n > 0 {
+				pending[rf] = splice(content, refSpan.Start, refSpan.End, text)
+			}
+		}
+	}
+	return pending, nil
+}
+
+// renameDecl 定义处的声明信息
+type renameDecl struct {
+	offset    int      // 声明名在定义文本中的偏移
+	receivers []string // TS 方法自引用的限定名: this 与类名
+}
+
+// declaration 定位定义文本中声明名的位置
+// Go 通过语法树取声明标识符；TS 取第一个不带限定的出现
+func (t renameTarget) declaration(path string, content []byte, span analysis.ChunkSpan, definition string) (renameDecl, error) {
+	decl := renameDecl{offset: -1}
+	if filepath.Ext(path) == ".go" {
+		fset := token.NewFileSet()
+		node, err := parser.ParseFile(fset, path, content, 0)
+		if err != nil {
+			return decl, err
+		}
+		offsetOf := func(ident *ast.Ident) int { return fset.Position(ident.Pos()).Offset - span.Start }
+		inSpan := func(ident *ast.Ident) bool {
+			offset := offsetOf(ident)
+			return ident.Name == t.oldName && offset >= 0 && offset < span.End-span.Start
+		}
+		for _, d := range node.Decls {
+			switch d := d.(type) {
+			case *ast.FuncDecl:
+				if inSpan(d.Name) {
+					decl.offset = offsetOf(d.Name)
+				}
+			case *ast.GenDecl:
+				for _, spec := range d.Specs {
+					switch spec := spec.(type) {
+					case *ast.TypeSpec:
+						if inSpan(spec.Name) {
+							decl.offset = offsetOf(spec.Name)
+						}
+					case *ast.ValueSpec:
+						for _, name := range spec.Names {
+							if inSpan(name) {
+								decl.offset = offsetOf(name)
+							}
+						}
+					}
+				}
+			}
+		}
+	} else {
+		replaceIdent(definition, t.oldName, t.oldName, false, func(src string, i int) bool {
+			if decl.offset < 0 && !qualifiedAt(src, i) {
+				decl.offset = i
+			}
+			return false
+		})
+		if t.member {
+			decl.receivers = []string{"this", t.class}
+		}
+	}
+	if decl.offset < 0 {
+		return decl, fmt.Errorf("declaration of %s not found in %s", t.oldName, span.ID)
+	}
+	return decl, nil
+}
+
+// acceptSelfReference 判断 TS 定义文本 src[i:] 处的标识符是否为自引用
+// 方法只接受以 this 或类名限定的 "this.name"；顶层符号 (递归调用、自引用类型) 同 acceptReference
+func (t renameTarget) acceptSelfReference(src string, i int, receivers []string) bool {
+	if !t.member {
+		return t.acceptReference(src, i)
+	}
+	j := i - 1
+	for j >= 0 && (src[j] == ' ' || src[j] == '\t') {
+		j--
+	}
+	if j < 0 || src[j] != '.' {
+		return false
+	}
+	end := j
+	for j > 0 && isIdentByte(src[j-1]) {
+		j--
+	}
+	return lo.Contains(receivers, src[j:end])
+}
+
+// referrers 通过符号索引查找引用了目标 Chunk 所定义符号的 Chunk (不含自身)
+// 目标不在索引中时报错，避免只改定义处
+func referrers(ids ...string) ([]*models.Chunk, error) {
+	var chunk *models.Chunk
+	for _, id := range lo.Uniq(ids) {
+		if c, err := storage.ChunkStorage.HGet(id); err == nil && c != nil {
+			chunk = c
+			break
+		}
+	}
+	if chunk == nil {
+		return nil, fmt.Errorf("%s is not indexed, references cannot be resolved; re-index before renaming", ids[0])
+	}
+	refIDs, err := storage.Indexer.GetReferrers(chunk.SymbolsDefined)
+	if err != nil {
+		return nil, fmt.Errorf("lookup referrers of %s: %w", chunk.ID, err)
+	}
+
+	var referrers []*models.Chunk
+	for _, id := range lo.Without(refIDs, chunk.ID) {
+		ref, err := storage.ChunkStorage.HGet(id)
+		if err != nil || ref == nil {
+			return nil, fmt.Errorf("referrer %s missing from chunk storage (index may be stale), rename aborted", id)
+		}
+		referrers = append(referrers, ref)
+	}
+	return referrers, nil
+}
+
+// qualifiedAt 判断 src[i:] 处的标识符前是否为成员访问的 "."
+func qualifiedAt(src string, i int) bool {
+	j := i - 1
+	for j >= 0 && (src[j] == ' ' || src[j] == '\t') {
+		j--
+	}
+	return j >= 0 && src[j] == '.'
+}
+
+// acceptReference 判断 TS 引用方 src[i:] 处的标识符是否为对顶层符号的引用: 只接受不带限定的 "Name"
+func (t renameTarget) acceptReference(src string, i int) bool {
+	return !qualifiedAt(src, i)
+}
+
+// replaceIdent 将 src 中作为完整标识符出现的 old 替换为 new，跳过字符串字面量；comments 为 true 时注释中的出现同样替换
+// accept 接收 src 与出现位置，返回 false 时保留原样；返回替换后的文本与替换次数
+func replaceIdent(src, old, new string, comments bool, accept func(src string, i int) bool) (string, int) {
+	var sb strings.Builder
+	count := 0
+	for i := 0; i < len(src); {
+		switch {
+		case strings.HasPrefix(src[i:], "//"):
+			end := strings.IndexByte(src[i:], '\n')
+			if end < 0 {
+				end = len(src) - i
+			}
+			text, n := replaceWords(src[i:i+end], old, new, func(int) bool { return comments })
+			sb.WriteString(text)
+			count += n
+			i += end
+		case strings.HasPrefix(src[i:], "/*"):
+			end := strings.Index(src[i+2:], "*/")
+			if end < 0 {
+				end = len(src) - i
+			} else {
+				end += 4
+			}
+			text, n := replaceWords(src[i:i+end], old, new, func(int) bool { return comments })
+			sb.WriteString(text)
+			count += n
+			i += end
+		case src[i] == '"' || src[i] == '\'' || src[i] == '`':
+			end := stringLiteralEnd(src, i)
+			sb.WriteString(src[i:end])
+			i = end
+		default:
+			// 代码片段: 直到下一个注释或字符串开始
+			end := i + 1
+			for end < len(src) && src[end] != '"' && src[end] != '\'' && src[end] != '`' &&
+				!strings.HasPrefix(src[end:], "//") && !strings.HasPrefix(src[end:], "/*") {
+				end++
+			}
+			base := i
+			text, n := replaceWords(src[i:end], old, new, func(at int) bool { return accept(src, base+at) })
+			sb.WriteString(text)
+			count += n
+			i = end
+		}
+	}
+	return sb.String(), count
+}
+
+// replaceWords 替换片段中作为完整单词出现的 old
+func replaceWords(s, old, new string, accept func(at int) bool) (string, int) {
+	var sb strings.Builder
+	count, last := 0, 0
+	for i := 0; i+len(old) <= len(s); {
+		j := strings.Index(s[i:], old)
+		if j < 0 {
+			break
+		}
+		at := i + j
+		end := at + len(old)
+		whole := (at == 0 || !isIdentByte(s[at-1])) && (end == len(s) || !isIdentByte(s[end]))
+		if whole && accept(at) {
+			sb.WriteString(s[last:at])
+			sb.WriteString(new)
+			last = end
+			count++
+		}
+		i = end
+	}
+	sb.WriteString(s[last:])
+	return sb.String(), count
+}
+
+// stringLiteralEnd 返回从 start 处引号开始的字符串字面量的结束偏移 (含闭合引号)
+// 反引号字符串 (Go raw string / TS 模板串) 不处理转义；未闭合时到行尾为止
+func stringLiteralEnd(src string, start int) int {
+	quote := src[start]
+	for i := start + 1; i < len(src); i++ {
+		switch {
+		case src[i] == '\\' && quote != '`':
+			i++
+		case src[i] == quote:
+			return i + 1
+		case src[i] == '\n' && quote != '`':
+			return i
+		}
+	}
+	return len(src)
+}
+
+func isIdentByte(b byte) bool {
+	return b == '_' || b == '$' || b >= 0x80 || ('0' <= b && b <= '9') || ('a' <= b && b <= 'z') || ('A' <= b && b <= 'Z')
+}
+
+// underDir 判断 path 是否位于 dir 之下 (两者均为绝对路径)
+func underDir(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// replacement 将 [start, end) 替换为 text
+type replacement struct {
+	start, end int
+	text       string
+}
+
+// applyReplacements 应用互不重叠的替换
+func applyReplacements(content []byte, replacements []replacement) []byte {
+	sort.Slice(replacements, func(i, j int) bool { return replacements[i].start > replacements[j].start })
+	for _, r := range replacements {
+		content = splice(content, r.start, r.end, r.text)
+	}
+	return content
+}
+
+// splice 返回用 text 替换 content[start:end] 后的新内容
+func splice(content []byte, start, end int, text string) []byte {
+	out := make([]byte, 0, len(content)-(end-start)+len(text))
+	out = append(out, content[:start]...)
+	out = append(out, text...)
+	return append(out, content[end:]...)
+}
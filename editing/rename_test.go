@@ -0,0 +1,216 @@
+package editing
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"sysevov2/models"
+)
+
+// writeModule 在临时目录中写入 go.mod 与 files (相对路径 -> 内容)，返回模块根目录
+func writeModule(t *testing.T, files map[string]string) string {
+	t.Helper()
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go toolchain not available")
+	}
+	root := t.TempDir()
+	files["go.mod"] = "module example.com/m\n\ngo 1.22\n"
+	for rel, content := range files {
+		path := filepath.Join(root, rel)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+// stageRenameMod 暂存一次 RENAME_SYMBOL
+func stageRenameMod(cs *Changeset, path, symbol, newName string) error {
+	return cs.Stage(&models.CodeModification{
+		ActionType:    models.ActionRenameSymbol,
+		FilePath:      path,
+		TargetChunkID: models.BuildChunkID(path, symbol),
+		NewContent:    newName,
+	})
+}
+
+// stagedContent 返回 path 在变更集中的暂存内容
+func stagedContent(t *testing.T, cs *Changeset, path string) string {
+	t.Helper()
+	f, err := cs.file(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(f.content)
+}
+
+func assertContains(t *testing.T, path, content string, want, notWant []string) {
+	t.Helper()
+	for _, s := range want {
+		if !strings.Contains(content, s) {
+			t.Errorf("%s: missing %q in\n%s", filepath.Base(path), s, content)
+		}
+	}
+	for _, s := range notWant {
+		if strings.Contains(content, s) {
+			t.Errorf("%s: unexpected %q in\n%s", filepath.Base(path), s, content)
+		}
+	}
+}
+
+const renameLib = `package lib
+
+// Store persists users
+type Store struct{}
+
+// Save stores u
+func (s *Store) Save(u *User) error { return nil }
+
+// User a user
+type User struct {
+	store *Store
+	Max   int
+}
+
+// Save saves the user through its store
+func (u *User) Save() error {
+	if u.store == nil {
+		return nil
+	}
+	return u.store.Save(u)
+}
+
+// Max returns the larger of a and b
+func Max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// Clamp limits v to Max(v, 0)
+func Clamp(v int) int { return Max(v, 0) }
+`
+
+const renameApp = `package app
+
+import "example.com/m/lib"
+
+// Run calls Save on the user and Max on the numbers
+func Run(u *lib.User, s *lib.Store) int {
+	u.Save()
+	s.Save(u)
+	Max := lib.Max(u.Max, 1)
+	return Max
+}
+`
+
+const renameTest = `package lib_test
+
+import (
+	"testing"
+
+	"example.com/m/lib"
+)
+
+func TestSave(t *testing.T) {
+	if err := (&lib.User{}).Save(); err != nil {
+		t.Fatal(err)
+	}
+}
+`
+
+func TestRenameGoMethod(t *testing.T) {
+	root := writeModule(t, map[string]string{
+		"lib/user.go":      renameLib,
+		"lib/user_test.go": renameTest,
+		"app/run.go":       renameApp,
+	})
+	lib := filepath.Join(root, "lib", "user.go")
+	cs := NewChangeset()
+	if err := stageRenameMod(cs, lib, "lib.User.Save", "Persist"); err != nil {
+		t.Fatalf("rename: %v", err)
+	}
+
+	assertContains(t, lib, stagedContent(t, cs, lib),
+		[]string{"// Persist saves the user", "func (u *User) Persist() error", "return u.store.Save(u)", "// Save stores u", "func (s *Store) Save("},
+		[]string{"u.store.Persist"})
+	app := filepath.Join(root, "app", "run.go")
+	assertContains(t, app, stagedContent(t, cs, app),
+		[]string{"\tu.Persist()", "\ts.Save(u)", "// Run calls Save on the user"},
+		[]string{"s.Persist", "calls Persist"})
+	test := filepath.Join(root, "lib", "user_test.go")
+	assertContains(t, test, stagedContent(t, cs, test), []string{"(&lib.User{}).Persist()"}, nil)
+}
+
+func TestRenameGoTopLevel(t *testing.T) {
+	root := writeModule(t, map[string]string{
+		"lib/user.go": renameLib,
+		"app/run.go":  renameApp,
+	})
+	lib := filepath.Join(root, "lib", "user.go")
+	cs := NewChangeset()
+	if err := stageRenameMod(cs, lib, "lib.Max", "Larger"); err != nil {
+		t.Fatalf("rename: %v", err)
+	}
+
+	// 同名字段与引用方中的局部变量、注释保持不变；定义处的注释随之改名
+	assertContains(t, lib, stagedContent(t, cs, lib),
+		[]string{"// Larger returns the larger", "func Larger(a, b int) int", "return Larger(v, 0)", "\tMax   int", "// Clamp limits v to Max(v, 0)"},
+		nil)
+	app := filepath.Join(root, "app", "run.go")
+	assertContains(t, app, stagedContent(t, cs, app),
+		[]string{"Max := lib.Larger(u.Max, 1)", "return Max", "and Max on the numbers"},
+		[]string{"lib.Max"})
+}
+
+func TestRenameGoAborts(t *testing.T) {
+	tests := []struct {
+		name   string
+		files  map[string]string
+		symbol string
+	}{
+		// 其他包存在类型错误时引用无法完整解析，不做部分改名
+		{"type error elsewhere", map[string]string{
+			"lib/user.go": renameLib,
+			"app/run.go":  renameApp + "\nfunc broken() { undefinedCall() }\n",
+		}, "lib.User.Save"},
+		{"unknown chunk", map[string]string{
+			"lib/user.go": renameLib,
+		}, "lib.User.Missing"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := writeModule(t, tt.files)
+			lib := filepath.Join(root, "lib", "user.go")
+			cs := NewChangeset()
+			if err := stageRenameMod(cs, lib, tt.symbol, "Persist"); err == nil {
+				t.Fatalf("rename succeeded, want error")
+			}
+			if paths := cs.Paths(); len(paths) != 0 {
+				t.Errorf("files staged after a failed rename: %v", paths)
+			}
+		})
+	}
+}
+
+func TestRenameGoOutsideModule(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "lib.go")
+	if err := os.WriteFile(path, []byte("package lib\n\nfunc Max() {}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cs := NewChangeset()
+	if err := stageRenameMod(cs, path, "lib.Max", "Larger"); err == nil {
+		t.Fatalf("rename outside a Go module succeeded, want error")
+	}
+	if got := stagedContent(t, cs, path); !strings.Contains(got, "func Max()") {
+		t.Errorf("content changed after a failed rename:\n%s", got)
+	}
+}
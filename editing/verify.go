@@ -0,0 +1,357 @@
+package editing
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"sysevov2/analysis"
+	"sysevov2/config"
+	"sysevov2/models"
+
+	"github.com/samber/lo"
+	"golang.org/x/tools/go/packages"
+)
+
+// CompileError 一条编译或类型检查错误；ChunkID 为出错行所在的 Chunk，无法定位时为空
+type CompileError struct {
+	File    string // 绝对路径
+	Line    int
+	Column  int
+	Message string
+	ChunkID string
+}
+
+func (e CompileError) String() string {
+	return fmt.Sprintf("%s:%d:%d: %s", e.File, e.Line, e.Column, e.Message)
+}
+
+// CheckFiles 对 paths 所在的 Go 包做类型检查 (含测试文件)，对所在的 TS 项目运行 tsc --noEmit
+// 已删除的文件以其所在目录参与检查；找不到 tsc 时跳过 TS。返回的错误按文件、行排序并标注 ChunkID
+func CheckFiles(paths []string) ([]CompileError, error) {
+	var tsFiles []string
+	for _, path := range paths {
+		switch filepath.Ext(path) {
+		case ".ts", ".tsx":
+			abs, err := filepath.Abs(path)
+			if err != nil {
+				return nil, err
+			}
+			tsFiles = append(tsFiles, abs)
+		}
+	}
+
+	goErrs, err := checkGoFiles(paths)
+	if err != nil {
+		return nil, err
+	}
+	tsErrs, err := checkTSFiles(tsFiles)
+	if err != nil {
+		return nil, err
+	}
+	all := lo.UniqBy(append(goErrs, tsErrs...), func(e CompileError) string { return e.String() })
+
+	locateErrorChunks(all)
+	sort.Slice(all, func(i, j int) bool {
+		if all[i].File != all[j].File {
+			return all[i].File < all[j].File
+		}
+		if all[i].Line != all[j].Line {
+			return all[i].Line < all[j].Line
+		}
+		return all[i].Column < all[j].Column
+	})
+	return all, nil
+}
+
+// NewCompileErrors 返回 current 中 baseline 没有的错误
+// 按 文件 + 消息 计数比较：修改会使行号整体偏移，修改前已存在的错误不应被归咎于本次修改
+func NewCompileErrors(baseline, current []CompileError) []CompileError {
+	key := func(e CompileError) string { return e.File + "\x00" + e.Message }
+	seen := make(map[string]int)
+	for _, e := range baseline {
+		seen[key(e)]++
+	}
+	var fresh []CompileError
+	for _, e := range current {
+		if seen[key(e)] > 0 {
+			seen[key(e)]--
+			continue
+		}
+		fresh = append(fresh, e)
+	}
+	return fresh
+}
+
+// GoPackagePatterns 将 Go 文件所在目录按所属模块分组: 模块根目录 -> ["./rel/dir", ...]
+// 已不含 Go 文件的目录 (如唯一的文件被删除) 被跳过
+func GoPackagePatterns(paths []string) (map[string][]string, error) {
+	byModule := make(map[string][]string)
+	for _, path := range paths {
+		if filepath.Ext(path) != ".go" {
+			continue
+		}
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return nil, err
+		}
+		dir := filepath.Dir(abs)
+		if !hasGoFiles(dir) {
+			continue
+		}
+		root := findUp(dir, "go.mod")
+		if root == "" {
+			return nil, fmt.Errorf("no go.mod found above %s", dir)
+		}
+		rel, err := filepath.Rel(root, dir)
+		if err != nil {
+			return nil, err
+		}
+		if pattern := "./" + filepath.ToSlash(rel); !lo.Contains(byModule[root], pattern) {
+			byModule[root] = append(byModule[root], pattern)
+		}
+	}
+	return byModule, nil
+}
+
+// GoModuleRoot 返回 path 所属 Go 模块的根目录 (向上最近的 go.mod 所在目录)，不属于任何模块时返回空
+func GoModuleRoot(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return ""
+	}
+	return findUp(filepath.Dir(abs), "go.mod")
+}
+
+// checkGoFiles 用 go/packages 对文件所在的包 (含测试变体) 做类型检查
+func checkGoFiles(paths []string) ([]CompileError, error) {
+	byModule, err := GoPackagePatterns(paths)
+	if err != nil {
+		return nil, err
+	}
+
+	var errs []CompileError
+	for root, patterns := range byModule {
+		// 测试变体需要依赖包的类型信息，NeedDeps 使依赖同样从源码检查
+		cfg := &packages.Config{
+			Mode: packages.NeedName | packages.NeedFiles | packages.NeedSyntax |
+				packages.NeedImports | packages.NeedDeps | packages.NeedTypes,
+			Dir:   root,
+			Tests: true,
+		}
+		pkgs, err := packages.Load(cfg, patterns...)
+		if err != nil {
+			return nil, fmt.Errorf("load packages in %s: %w", root, err)
+		}
+		for _, pkg := range pkgs {
+			for _, e := range pkg.Errors {
+				file, line, col := parsePosition(e.Pos)
+				if file != "" && !filepath.IsAbs(file) {
+					file = filepath.Join(root, file)
+				}
+				errs = append(errs, CompileError{File: file, Line: line, Column: col, Message: e.Msg})
+			}
+		}
+	}
+	return errs, nil
+}
+
+func hasGoFiles(dir string) bool {
+	matches, _ := filepath.Glob(filepath.Join(dir, "*.go"))
+	return len(matches) > 0
+}
+
+// parsePosition 解析 "file:line:col" / "file:line"；无位置信息时 file 为空
+func parsePosition(pos string) (file string, line, col int) {
+	if pos == "" || pos == "-" {
+		return "", 0, 0
+	}
+	parts := strings.Split(pos, ":")
+	nums := []int{}
+	for len(parts) > 1 && len(nums) < 2 {
+		n, err := strconv.Atoi(parts[len(parts)-1])
+		if err != nil {
+			break
+		}
+		nums = append([]int{n}, nums...)
+		parts = parts[:len(parts)-1]
+	}
+	file = strings.Join(parts, ":")
+	if len(nums) > 0 {
+		line = nums[0]
+	}
+	if len(nums) > 1 {
+		col = nums[1]
+	}
+	return file, line, col
+}
+
+// tscDiagnostic tsc --pretty false 的输出行: "src/a.ts(12,5): error TS2304: Cannot find name 'x'."
+var tscDiagnostic = regexp.MustCompile(`^(.+?)\((\d+),(\d+)\): error (TS\d+: .*)$`)
+
+// checkTSFiles 按最近的 tsconfig.json 分组，每个项目运行一次 tsc --noEmit
+func checkTSFiles(files []string) ([]CompileError, error) {
+	projects := lo.Uniq(lo.FilterMap(files, func(file string, _ int) (string, bool) {
+		dir := findUp(filepath.Dir(file), "tsconfig.json")
+		return dir, dir != ""
+	}))
+
+	var errs []CompileError
+	for _, project := range projects {
+		tsc := tscBinary(project)
+		if tsc == "" {
+			fmt.Printf("⚠️ tsc not found, skipping TS verification for %s\n", project)
+			continue
+		}
+		cmd := exec.Command(tsc, "--noEmit", "--pretty", "false", "-p", project)
+		cmd.Dir = project
+		out, err := cmd.CombinedOutput()
+		var exitErr *exec.ExitError
+		if err != nil && !errors.As(err, &exitErr) {
+			return nil, fmt.Errorf("run tsc in %s: %w", project, err)
+		}
+		found := 0
+		for _, line := range strings.Split(string(out), "\n") {
+			m := tscDiagnostic.FindStringSubmatch(strings.TrimSpace(line))
+			if m == nil {
+				continue
+			}
+			file := m[1]
+			if !filepath.IsAbs(file) {
+				file = filepath.Join(project, file)
+			}
+			lineNo, _ := strconv.Atoi(m[2])
+			col, _ := strconv.Atoi(m[3])
+			errs = append(errs, CompileError{File: file, Line: lineNo, Column: col, Message: m[4]})
+			found++
+		}
+		// 非零退出但没有可解析的诊断 (如 tsconfig 本身有误)，整体作为一条错误
+		if err != nil && found == 0 {
+			errs = append(errs, CompileError{File: filepath.Join(project, "tsconfig.json"), Message: strings.TrimSpace(string(out))})
+		}
+	}
+	return errs, nil
+}
+
+func tscBinary(project string) string {
+	if config.Verify.TscBinary != "" {
+		return config.Verify.TscBinary
+	}
+	local := filepath.Join(project, "node_modules", ".bin", "tsc")
+	if _, err := os.Stat(local); err == nil {
+		return local
+	}
+	if path, err := exec.LookPath("tsc"); err == nil {
+		return path
+	}
+	return ""
+}
+
+// findUp 从 dir 向上查找包含 name 的目录，找不到时返回空
+func findUp(dir, name string) string {
+	for {
+		if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+			return dir
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// locateErrorChunks 为每个错误标注出错行所在的最内层 Chunk
+func locateErrorChunks(errs []CompileError) {
+	type located struct {
+		content []byte
+		spans   []analysis.ChunkSpan
+	}
+	files := make(map[string]*located)
+	for i := range errs {
+		e := &errs[i]
+		if e.File == "" || e.Line <= 0 {
+			continue
+		}
+		f, ok := files[e.File]
+		if !ok {
+			f = &located{}
+			if content, err := os.ReadFile(e.File); err == nil {
+				f.content = content
+				f.spans, _ = analysis.LocateChunks(e.File, content)
+			}
+			files[e.File] = f
+		}
+		offset := lineOffset(f.content, e.Line) + max(e.Column-1, 0)
+		best := -1
+		for j, span := range f.spans {
+			if span.Start <= offset && offset < span.End && (best < 0 || span.End-span.Start < f.spans[best].End-f.spans[best].Start) {
+				best = j
+			}
+		}
+		if best >= 0 {
+			e.ChunkID = f.spans[best].ID
+		}
+	}
+}
+
+// lineOffset 返回第 line 行 (从 1 开始) 行首的字节偏移
+func lineOffset(content []byte, line int) int {
+	offset := 0
+	for n := 1; n < line; n++ {
+		i := bytes.IndexByte(content[offset:], '\n')
+		if i < 0 {
+			return len(content)
+		}
+		offset += i + 1
+	}
+	return offset
+}
+
+// ReadChunk 返回文件中 chunkID 对应的当前源码
+func ReadChunk(path, chunkID string) (string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	span, err := findChunkRange(path, content, chunkID)
+	if err != nil {
+		return "", err
+	}
+	if span.Start < 0 {
+		return "", fmt.Errorf("chunk not found: %s", chunkID)
+	}
+	return string(content[span.Start:span.End]), nil
+}
+
+// ReadTestFunctions 在 dirs 下的 _test.go 文件中查找名为 names 的顶层函数，返回 ChunkID -> 当前源码
+func ReadTestFunctions(dirs []string, names []string) map[string]string {
+	found := make(map[string]string)
+	for _, dir := range lo.Uniq(dirs) {
+		files, _ := filepath.Glob(filepath.Join(dir, "*_test.go"))
+		for _, file := range files {
+			content, err := os.ReadFile(file)
+			if err != nil {
+				continue
+			}
+			spans, err := analysis.LocateGoChunks(file, content)
+			if err != nil {
+				continue
+			}
+			for _, span := range spans {
+				_, symbol, _ := models.SplitChunkID(span.ID)
+				if lo.ContainsBy(names, func(name string) bool { return symbol == name || strings.HasSuffix(symbol, "."+name) }) {
+					found[span.ID] = string(content[span.Start:span.End])
+				}
+			}
+		}
+	}
+	return found
+}
@@ -16,6 +16,7 @@ require (
 	github.com/sashabaranov/go-openai v1.41.2
 	github.com/spf13/afero v1.12.0
 	golang.design/x/clipboard v0.7.1
+	golang.org/x/tools v0.41.0
 	google.golang.org/genai v1.42.0
 )
 
@@ -55,6 +56,7 @@ require (
 	golang.org/x/exp/shiny v0.0.0-20260112195511-716be5621a96 // indirect
 	golang.org/x/image v0.35.0 // indirect
 	golang.org/x/mobile v0.0.0-20251209145715-2553ed8ce294 // indirect
+	golang.org/x/mod v0.32.0 // indirect
 	golang.org/x/net v0.49.0 // indirect
 	golang.org/x/sync v0.19.0 // indirect
 	golang.org/x/sys v0.40.0 // indirect
@@ -14,15 +14,19 @@ import (
 
 // Model represents an OpenAI model with its associated client and model name.
 type Model struct {
-	Client          *openai.Client
-	ApiKey          string // API key for authentication
-	SystemMessage   string
-	BaseURL         string // Base URL for the OpenAI API, can be empty for default
-	Name            string
-	TopP            float32
-	TopK            float32
-	Temperature     float32
-	ToolInPrompt    *ToolInPrompt
+	Client        *openai.Client
+	ApiKey        string // API key for authentication
+	SystemMessage string
+	BaseURL       string // Base URL for the OpenAI API, can be empty for default
+	Name          string
+	TopP          float32
+	TopK          float32
+	Temperature   float32
+	ToolInPrompt  *ToolInPrompt
+	// ContextWindow 模型上下文窗口 (Token)，0 表示使用 DefaultContextWindow
+	ContextWindow int
+	// Encoding BPE 词表名 (如 "cl100k_base")，为空时按模型名推断
+	Encoding        string
 	avgResponseTime time.Duration
 	lastReceived    time.Time
 	requestPerMin   float64
@@ -126,42 +130,77 @@ func (m *Model) WithSysPrompt(message string) *Model {
 	m.SystemMessage = message
 	return m
 }
+func (m *Model) WithContextWindow(tokens int) *Model {
+	m.ContextWindow = tokens
+	return m
+}
+
+func (m *Model) WithEncoding(encoding string) *Model {
+	m.Encoding = encoding
+	return m
+}
+
+// DefaultContextWindow 未设置 ContextWindow 时采用的保守窗口大小 (Token)
+const DefaultContextWindow = 32000
+
+// Tokenizer 返回模型对应的 Token 计数器
+func (m *Model) Tokenizer() Tokenizer {
+	encoding := m.Encoding
+	if encoding == "" {
+		encoding = encodingOf(m.Name)
+	}
+	return TokenizerFor(encoding)
+}
+
+// CountTokens 按模型的词表统计 Token 数
+func (m *Model) CountTokens(text string) int {
+	return m.Tokenizer().CountTokens(text)
+}
+
+// ContextTokens 返回模型可用的上下文窗口大小
+func (m *Model) ContextTokens() int {
+	if m.ContextWindow > 0 {
+		return m.ContextWindow
+	}
+	return DefaultContextWindow
+}
 
+// 各模型的 ContextWindow 取官方公布的上下文长度；本地部署若以更小的 max-model-len 启动，需同步调小
 var (
-	DeepSeekV3 = NewModel("https://api.deepseek.com/", utils.ReadFile("/Users/yang/eloevo/.vscode/DSAPIKEY.txt"), "deepseek-chat").WithTopP(0.6).WithToolsInSystemPrompt()
+	DeepSeekV3 = NewModel("https://api.deepseek.com/", utils.ReadFile("/Users/yang/eloevo/.vscode/DSAPIKEY.txt"), "deepseek-chat").WithTopP(0.6).WithToolsInSystemPrompt().WithContextWindow(128000)
 	//https://tbnx.plus7.plus/token
-	DeepSeekV3TB = NewModel("https://tbnx.plus7.plus/v1", os.Getenv("DSTB"), "deepseek-chat").WithTopP(0.6)
-	GeminiTB     = NewModel("https://tao.plus7.plus/v1", os.Getenv("geminitb"), "gemini-2.0-flash-exp").WithTopP(0.8).WithToolsInUserPrompt()
+	DeepSeekV3TB = NewModel("https://tbnx.plus7.plus/v1", os.Getenv("DSTB"), "deepseek-chat").WithTopP(0.6).WithContextWindow(128000)
+	GeminiTB     = NewModel("https://tao.plus7.plus/v1", os.Getenv("geminitb"), "gemini-2.0-flash-exp").WithTopP(0.8).WithToolsInUserPrompt().WithContextWindow(1048576)
 	//多模态回答生成仅在 gemini-2.0-flash-exp 和 gemini-2.0-flash-preview-image-generation
-	GPT5Aigpt     = NewModel("https://api.aigptapi.com/v1", "apgptapi", "gpt-5")
-	GPT5ChatAigpt = NewModel("https://api.aigptapi.com/v1", "apgptapi", "gpt-5-chat-latest").WithToolsInUserPrompt()
+	GPT5Aigpt     = NewModel("https://api.aigptapi.com/v1", "apgptapi", "gpt-5").WithContextWindow(400000)
+	GPT5ChatAigpt = NewModel("https://api.aigptapi.com/v1", "apgptapi", "gpt-5-chat-latest").WithToolsInUserPrompt().WithContextWindow(128000)
 
-	Qwen30BA3             = NewModel("http://rtxserver.lan:12303/v1", "ApiKey", "qwen3b30a3b2507").WithTemperature(0.7).WithTopP(0.8)
-	Qwen3B235Thinking2507 = NewModel("http://rtxserver.lan:12303/v1", "ApiKey", "qwen3-235b-a22b-thinking-2507")
-	Qwen3vl30b            = NewModel("http://rtxserver.lan:12304/v1", "ApiKey", "qwen3-vl-30b")
-	Qwen3vl8b             = NewModel("http://rtxserver.lan:12304/v1", "ApiKey", "qwen3-vl-8b")
+	Qwen30BA3             = NewModel("http://rtxserver.lan:12303/v1", "ApiKey", "qwen3b30a3b2507").WithTemperature(0.7).WithTopP(0.8).WithContextWindow(262144)
+	Qwen3B235Thinking2507 = NewModel("http://rtxserver.lan:12303/v1", "ApiKey", "qwen3-235b-a22b-thinking-2507").WithContextWindow(262144)
+	Qwen3vl30b            = NewModel("http://rtxserver.lan:12304/v1", "ApiKey", "qwen3-vl-30b").WithContextWindow(262144)
+	Qwen3vl8b             = NewModel("http://rtxserver.lan:12304/v1", "ApiKey", "qwen3-vl-8b").WithContextWindow(262144)
 
-	Qwen3Next80BThinking = NewModel("http://rtxserver.lan:12303/v1", "ApiKey", "qwen3-next-80b-thinking")
-	Qwen3Next80B         = NewModel("http://rtxserver.lan:12304/v1", "ApiKey", "qwen3-next-80b")
-	Qwendeepresearch     = NewModel("http://rtxserver.lan:12304/v1", "ApiKey", "deepresearch").WithToolsInUserPrompt()
+	Qwen3Next80BThinking = NewModel("http://rtxserver.lan:12303/v1", "ApiKey", "qwen3-next-80b-thinking").WithContextWindow(262144)
+	Qwen3Next80B         = NewModel("http://rtxserver.lan:12304/v1", "ApiKey", "qwen3-next-80b").WithContextWindow(262144)
+	Qwendeepresearch     = NewModel("http://rtxserver.lan:12304/v1", "ApiKey", "deepresearch").WithToolsInUserPrompt().WithContextWindow(131072)
 
-	Qwen3B235Thinking2507Aliyun = NewModel("https://dashscope.aliyuncs.com/compatible-mode/v1", "aliyun", "qwen3-235b-a22b-thinking-2507")
+	Qwen3B235Thinking2507Aliyun = NewModel("https://dashscope.aliyuncs.com/compatible-mode/v1", "aliyun", "qwen3-235b-a22b-thinking-2507").WithContextWindow(131072)
 
-	Qwen3Coder            = NewModel("https://api.xiaocaseai.com/v1", "xiaocaseai", "qwen3-coder-480b-a35b-instruct")
-	Gemini25Proxiaocaseai = NewModel("https://api.xiaocaseai.com/v1", "xiaocaseai", "gemini-2.5-pro")
+	Qwen3Coder            = NewModel("https://api.xiaocaseai.com/v1", "xiaocaseai", "qwen3-coder-480b-a35b-instruct").WithContextWindow(262144)
+	Gemini25Proxiaocaseai = NewModel("https://api.xiaocaseai.com/v1", "xiaocaseai", "gemini-2.5-pro").WithContextWindow(1048576)
 
-	Qwen3Coder30B2507 = NewModel("http://rtxserver.lan:12304/v1", "ApiKey", "qwen3coder30b2507")
-	Qwen3B235B        = NewModel("https://api.xiaocaseai.com/v1", "xiaocaseai", "qwen3-235b-a22b")
+	Qwen3Coder30B2507 = NewModel("http://rtxserver.lan:12304/v1", "ApiKey", "qwen3coder30b2507").WithContextWindow(262144)
+	Qwen3B235B        = NewModel("https://api.xiaocaseai.com/v1", "xiaocaseai", "qwen3-235b-a22b").WithContextWindow(32768)
 
-	GLM45         = NewModel("https://open.bigmodel.cn/api/paas/v4/", "ZHIPUAPIKEY", "GLM-4.5")
-	Glm45Air      = NewModel("https://open.bigmodel.cn/api/paas/v4/", "ZHIPUAPIKEY", "GLM-4.5-Air")
-	Glm45AirLocal = NewModel("http://rtxserver.lan:12303/v1", "ApiKey", "GLM-4.5-Air").WithToolsInSystemPrompt()
+	GLM45         = NewModel("https://open.bigmodel.cn/api/paas/v4/", "ZHIPUAPIKEY", "GLM-4.5").WithContextWindow(131072)
+	Glm45Air      = NewModel("https://open.bigmodel.cn/api/paas/v4/", "ZHIPUAPIKEY", "GLM-4.5-Air").WithContextWindow(131072)
+	Glm45AirLocal = NewModel("http://rtxserver.lan:12303/v1", "ApiKey", "GLM-4.5-Air").WithToolsInSystemPrompt().WithContextWindow(131072)
 
-	Minmaxm2_1 = NewModel("http://rtxserver.lan:8000/v1", "", "mmm-2.1")
+	Minmaxm2_1 = NewModel("http://rtxserver.lan:8000/v1", "", "mmm-2.1").WithContextWindow(204800)
 
-	Qwen3B32Thinking = NewModel("http://rtxserver.lan:1214/v1", "ApiKey", "qwen3b32").WithTemperature(0.6).WithTopP(0.95)
-	Oss120b          = NewModel("http://rtxserver.lan:12304/v1", "ApiKey", "gpt-oss-120b")
-	Oss20b           = NewModel("http://rtxserver.lan:12302/v1", "ApiKey", "gpt-oss-20b").WithSysPrompt("Reasoning: high")
+	Qwen3B32Thinking = NewModel("http://rtxserver.lan:1214/v1", "ApiKey", "qwen3b32").WithTemperature(0.6).WithTopP(0.95).WithContextWindow(32768)
+	Oss120b          = NewModel("http://rtxserver.lan:12304/v1", "ApiKey", "gpt-oss-120b").WithContextWindow(131072)
+	Oss20b           = NewModel("http://rtxserver.lan:12302/v1", "ApiKey", "gpt-oss-20b").WithSysPrompt("Reasoning: high").WithContextWindow(131072)
 
 	//ModelDefault        = ModelQwen32BCoderLocal
 	ModelDefault = Minmaxm2_1
@@ -0,0 +1,197 @@
+package llm
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+
+	"sysevov2/config"
+)
+
+// Tokenizer 文本的 Token 计数
+type Tokenizer interface {
+	CountTokens(text string) int
+}
+
+// bpeTokenizer 读取 tiktoken 格式词表的字节级 BPE，只计数不输出 Token ID
+type bpeTokenizer struct {
+	ranks map[string]int
+	// counts: 预切分片段 -> Token 数，代码中的标识符与符号高度重复
+	counts sync.Map
+}
+
+// bpePretokenizer 近似 cl100k 的预切分规则 (Go regexp 不支持 \s+(?!\S) 这类前瞻，差异只影响空白的归属)
+var bpePretokenizer = regexp.MustCompile(`(?i:'s|'t|'re|'ve|'m|'ll|'d)|[^\r\n\p{L}\p{N}]?\p{L}+|\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n]*|\s*[\r\n]+|\s+`)
+
+// LoadTiktokenFile 加载 tiktoken 词表: 每行 "<base64 token> <rank>"
+func LoadTiktokenFile(path string) (Tokenizer, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	ranks := make(map[string]int)
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		token, rank, ok := strings.Cut(line, " ")
+		if !ok {
+			return nil, fmt.Errorf("%s:%d: malformed tiktoken line", path, lineNo)
+		}
+		raw, err := base64.StdEncoding.DecodeString(token)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, lineNo, err)
+		}
+		n, err := strconv.Atoi(rank)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, lineNo, err)
+		}
+		ranks[string(raw)] = n
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return &bpeTokenizer{ranks: ranks}, nil
+}
+
+func (t *bpeTokenizer) CountTokens(text string) int {
+	total := 0
+	for _, piece := range bpePretokenizer.FindAllString(text, -1) {
+		if _, ok := t.ranks[piece]; ok {
+			total++
+			continue
+		}
+		if n, ok := t.counts.Load(piece); ok {
+			total += n.(int)
+			continue
+		}
+		n := t.mergeCount([]byte(piece))
+		t.counts.Store(piece, n)
+		total += n
+	}
+	return total
+}
+
+// mergeCount 反复合并 rank 最小的相邻字节对，返回最终片段数
+func (t *bpeTokenizer) mergeCount(piece []byte) int {
+	// bounds[i]: 第 i 个片段的起始偏移，末尾为 len(piece)
+	bounds := make([]int, len(piece)+1)
+	for i := range bounds {
+		bounds[i] = i
+	}
+	for len(bounds) > 2 {
+		minRank, minIdx := math.MaxInt, -1
+		for i := 0; i+2 < len(bounds); i++ {
+			if rank, ok := t.ranks[string(piece[bounds[i]:bounds[i+2]])]; ok && rank < minRank {
+				minRank, minIdx = rank, i
+			}
+		}
+		if minIdx < 0 {
+			break
+		}
+		bounds = append(bounds[:minIdx+1], bounds[minIdx+2:]...)
+	}
+	return len(bounds) - 1
+}
+
+// heuristicTokenizer 无词表时的估算: 英文单词与数字约 5 字符 1 个 Token，
+// 标点与运算符各算 1 个，CJK 字符按 1.5 个计 (BPE 词表中的汉字大多占 1~2 个 Token)
+type heuristicTokenizer struct{}
+
+func (heuristicTokenizer) CountTokens(text string) int {
+	halves, word := 0, 0
+	flushWord := func() {
+		halves += 2 * ((word + 4) / 5)
+		word = 0
+	}
+	for _, r := range text {
+		switch {
+		case isCJK(r):
+			flushWord()
+			halves += 3
+		case r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'):
+			word++
+		case r == '\n':
+			flushWord()
+			halves += 2
+		case unicode.IsSpace(r):
+			flushWord()
+		default:
+			flushWord()
+			halves += 2
+		}
+	}
+	flushWord()
+	return (halves + 1) / 2
+}
+
+func isCJK(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul) ||
+		(r >= 0x3000 && r <= 0x303F) || (r >= 0xFF00 && r <= 0xFFEF) // 全角标点
+}
+
+// HeuristicTokenizer 词表缺失时的兜底
+var HeuristicTokenizer Tokenizer = heuristicTokenizer{}
+
+// TiktokenSources 各编码词表的下载地址，下载后以 <encoding>.tiktoken 存放到 config.Tokenizer.Dir
+// qwen 取自 Qwen-7B 仓库，Qwen2/3 的常规词表与之相同，特殊 Token 不影响计数
+var TiktokenSources = map[string]string{
+	"cl100k_base": "https://openaipublic.blob.core.windows.net/encodings/cl100k_base.tiktoken",
+	"o200k_base":  "https://openaipublic.blob.core.windows.net/encodings/o200k_base.tiktoken",
+	"qwen":        "https://huggingface.co/Qwen/Qwen-7B/resolve/main/qwen.tiktoken",
+}
+
+var (
+	tokenizersMutex sync.Mutex
+	// tokenizers: 编码名 -> 已加载的 Tokenizer (加载失败时缓存为 HeuristicTokenizer，因此每个编码只告警一次)
+	tokenizers = make(map[string]Tokenizer)
+)
+
+// TokenizerFor 返回编码对应的 Tokenizer，首次使用时从 config.Tokenizer.Dir/<encoding>.tiktoken 加载
+func TokenizerFor(encoding string) Tokenizer {
+	tokenizersMutex.Lock()
+	defer tokenizersMutex.Unlock()
+	if t, ok := tokenizers[encoding]; ok {
+		return t
+	}
+	path := filepath.Join(config.Tokenizer.Dir, encoding+".tiktoken")
+	t, err := LoadTiktokenFile(path)
+	if err != nil {
+		fmt.Printf("⚠️ Tokenizer %s unavailable, token counts for it are heuristic estimates: %v\n", encoding, err)
+		if url, ok := TiktokenSources[encoding]; ok {
+			abs, _ := filepath.Abs(path)
+			fmt.Printf("   To count exactly: curl -L --create-dirs -o %s %s\n", abs, url)
+		}
+		t = HeuristicTokenizer
+	}
+	tokenizers[encoding] = t
+	return t
+}
+
+// encodingOf 按模型名推断 BPE 编码；其余 OpenAI 兼容模型 (DeepSeek、GLM、MiniMax 等) 的词表
+// 与 cl100k 同为字节级 BPE，用 cl100k 近似
+func encodingOf(modelName string) string {
+	name := strings.ToLower(modelName)
+	switch {
+	case strings.HasPrefix(name, "gpt-4o"), strings.HasPrefix(name, "gpt-4.1"), strings.HasPrefix(name, "gpt-5"),
+		strings.HasPrefix(name, "gpt-oss"), strings.HasPrefix(name, "o1"), strings.HasPrefix(name, "o3"), strings.HasPrefix(name, "o4"):
+		return "o200k_base"
+	case strings.HasPrefix(name, "qwen"):
+		return "qwen"
+	default:
+		return "cl100k_base"
+	}
+}
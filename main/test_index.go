@@ -11,7 +11,7 @@ func Test_index() {
 	}
 
 	// 指定运行线程数，例如 4 线程
-	err := analysis.RunParallelIndexing(projectRoots, 1)
+	_, err := analysis.RunParallelIndexing(projectRoots, 1)
 	if err != nil {
 		log.Fatalf("Failed to index codebase: %v", err)
 	}
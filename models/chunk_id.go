@@ -0,0 +1,74 @@
+package models
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ChunkID 规则: "{filepath}:{symbol}[#ordinal]"
+//   - Go:  symbol = "{package}.{Name}" 或 "{package}.{Recv}.{Method}"
+//     Recv 去掉指针与类型参数: *Tool[v] -> Tool
+//   - TS:  symbol = "{Name}" 或 "{Class}.{Method}"
+//
+// 同一文件内的重名声明 (多个 init、TS 重载签名等) 从第二个开始追加序号: "#2", "#3" ...
+// 文件头 Chunk 固定为 "{filepath}:@header"
+const (
+	chunkOrdinalSep = "#"
+	HeaderSymbol    = "@header"
+)
+
+// BuildChunkID 拼接文件路径与符号 (不含序号)
+func BuildChunkID(filePath, symbol string) string {
+	return fmt.Sprintf("%s:%s", filePath, symbol)
+}
+
+// HeaderChunkID 返回文件头 Chunk 的 ID
+func HeaderChunkID(filePath string) string {
+	return BuildChunkID(filePath, HeaderSymbol)
+}
+
+// SplitChunkID 拆分 ChunkID 为文件路径、符号与序号 (无序号时为 1)
+func SplitChunkID(id string) (filePath, symbol string, ordinal int) {
+	id = strings.TrimSpace(id)
+	ordinal = 1
+	if i := strings.LastIndex(id, ":"); i >= 0 {
+		filePath, symbol = id[:i], id[i+1:]
+	} else {
+		symbol = id
+	}
+	if i := strings.LastIndex(symbol, chunkOrdinalSep); i > 0 {
+		if n, err := strconv.Atoi(symbol[i+1:]); err == nil && n > 1 {
+			symbol, ordinal = symbol[:i], n
+		}
+	}
+	return filePath, strings.TrimSpace(symbol), ordinal
+}
+
+// HostSymbol 返回方法符号的宿主: "pkg.User.Save" -> "pkg.User", "Class.method" -> "Class"
+func HostSymbol(symbol string) string {
+	if i := strings.LastIndex(symbol, "."); i > 0 {
+		return symbol[:i]
+	}
+	return ""
+}
+
+// ChunkIDAllocator 在单个文件内分配 ChunkID，为重名符号追加序号
+type ChunkIDAllocator struct {
+	filePath string
+	seen     map[string]int
+}
+
+func NewChunkIDAllocator(filePath string) *ChunkIDAllocator {
+	return &ChunkIDAllocator{filePath: filePath, seen: make(map[string]int)}
+}
+
+// Next 按声明顺序为 symbol 分配 ID；首次出现不带序号
+func (a *ChunkIDAllocator) Next(symbol string) string {
+	a.seen[symbol]++
+	id := BuildChunkID(a.filePath, symbol)
+	if n := a.seen[symbol]; n > 1 {
+		id += chunkOrdinalSep + strconv.Itoa(n)
+	}
+	return id
+}
@@ -7,23 +7,74 @@ type CodeModification struct {
 	FilePath string `json:"file_path" description:"Required. The target file path."`
 
 	// 核心定位: ChunkID
-	// 格式: "path/to/file.go:FuncName" 或 "path/to/file.go:TypeName"
-	// 如果是新增文件或全局追加，留空或使用 "EOF"
-	TargetChunkID string `json:"target_chunk_id" description:"Required. The ID of the code chunk to modify. e.g. 'main.go:User.Save'."`
+	// 格式: "path/to/file.go:pkg.FuncName" 或 "path/to/file.go:pkg.TypeName" (规则见 chunk_id.go)
+	// INSERT_BEFORE / INSERT_AFTER 时为锚点 Chunk；如果是新增文件或全局追加，留空或使用 "EOF"
+	TargetChunkID string `json:"target_chunk_id" description:"Required. The ID of the code chunk to modify, or the anchor chunk for INSERT_BEFORE/INSERT_AFTER. e.g. 'main.go:main.User.Save'. Leave empty for CREATE_FILE and APPEND."`
 
 	// 变更类型
-	ActionType string `json:"action_type" description:"One of: 'MODIFY', 'DELETE', 'CREATE_FILE'"`
+	ActionType string `json:"action_type" description:"One of: 'MODIFY' (replace the target chunk), 'DELETE' (remove the target chunk, or the whole file when target_chunk_id is empty), 'CREATE_FILE', 'INSERT_BEFORE' / 'INSERT_AFTER' (add a new declaration right before/after the target chunk), 'RENAME_SYMBOL' (rename the symbol defined by the target chunk and update its references), 'APPEND' (add to the end of the file)"`
 
 	// 新代码内容
-	// 必须是完整的 AST 节点代码（包含签名、注释和函数体）
-	NewContent string `json:"new_content" description:"The complete new code for this chunk. Must be valid Go/TS code."`
+	// 必须是完整的 AST 节点代码（包含签名、注释和函数体）；RENAME_SYMBOL 时为新名称
+	NewContent string `json:"new_content" description:"The complete new code for this chunk (or the new declaration to insert). Must be valid Go/TS code. For RENAME_SYMBOL, only the new identifier."`
 
 	// 思维链 (CoT)
 	Reasoning string `json:"reasoning" description:"Why this change is necessary."`
 }
 
+// CodeModification.ActionType 的取值
+const (
+	ActionModify       = "MODIFY"
+	ActionDelete       = "DELETE"
+	ActionCreateFile   = "CREATE_FILE"
+	ActionInsertBefore = "INSERT_BEFORE"
+	ActionInsertAfter  = "INSERT_AFTER"
+	ActionRenameSymbol = "RENAME_SYMBOL"
+	ActionAppend       = "APPEND"
+)
+
 // Solution 代表针对一个目标的一组修改方案
+// 方案作为整体应用: 任一修改失败时全部不落盘，Errors 记录每个失败的修改
 type Solution struct {
 	Modifications []*CodeModification `json:"modifications"`
 	Status        string              `json:"status"` // "PENDING", "APPLIED", "FAILED"
+	Errors        []ModificationError `json:"errors,omitempty"`
+}
+
+const (
+	SolutionPending = "PENDING"
+	SolutionApplied = "APPLIED"
+	SolutionFailed  = "FAILED"
+)
+
+// ModificationError 单个修改的失败原因；Index 为其在 Modifications 中的下标
+type ModificationError struct {
+	Index         int    `json:"index"`
+	FilePath      string `json:"file_path"`
+	TargetChunkID string `json:"target_chunk_id"`
+	Error         string `json:"error"`
+}
+
+// NewSolution 创建待应用的方案
+func NewSolution(mods ...*CodeModification) *Solution {
+	return &Solution{Modifications: mods, Status: SolutionPending}
+}
+
+// FilePaths 返回方案涉及的文件 (去重，保持顺序)
+func (s *Solution) FilePaths() []string {
+	var paths []string
+	seen := make(map[string]bool)
+	for _, mod := range s.Modifications {
+		if !seen[mod.FilePath] {
+			seen[mod.FilePath] = true
+			paths = append(paths, mod.FilePath)
+		}
+	}
+	return paths
+}
+
+// AddError 记录第 index 个修改的失败原因
+func (s *Solution) AddError(index int, err error) {
+	mod := s.Modifications[index]
+	s.Errors = append(s.Errors, ModificationError{Index: index, FilePath: mod.FilePath, TargetChunkID: mod.TargetChunkID, Error: err.Error()})
 }
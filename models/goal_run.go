@@ -0,0 +1,28 @@
+package models
+
+// GoalRun 一次带验收条件的目标执行记录，RunID 与该次上下文选择的 SelectionTrace 相同
+type GoalRun struct {
+	RunID      string             `json:"run_id" msgpack:"run_id"`
+	Goal       string             `json:"goal" msgpack:"goal"`
+	Acceptance string             `json:"acceptance" msgpack:"acceptance"` // 验收命令，或 "go test -run ..." 的测试名
+	CreatedAt  int64              `json:"created_at" msgpack:"created_at"` // Unix Timestamp
+	Rounds     []*AcceptanceRound `json:"rounds" msgpack:"rounds"`
+	Passed     bool               `json:"passed" msgpack:"passed"`
+	// BestRound 最终保留的轮次 (通过的轮次，或全部失败时失败测试最少的轮次)；-1 表示全部回滚
+	BestRound int    `json:"best_round" msgpack:"best_round"`
+	Error     string `json:"error,omitempty" msgpack:"error"`
+}
+
+// AcceptanceRound 一轮修改及其验收结果；第 0 轮为目标的初始方案
+type AcceptanceRound struct {
+	Round         int      `json:"round" msgpack:"round"`
+	Modifications int      `json:"modifications" msgpack:"modifications"`
+	Files         []string `json:"files" msgpack:"files"`
+	Passed        bool     `json:"passed" msgpack:"passed"`
+	// Failures 失败的顶层测试名；命令验收或构建失败时为空
+	Failures   []string `json:"failures,omitempty" msgpack:"failures"`
+	Output     string   `json:"output" msgpack:"output"` // 截断后的输出尾部
+	DurationMs int64    `json:"duration_ms" msgpack:"duration_ms"`
+	// Error 本轮方案未能应用 (应用失败或编译修复失败已回滚) 时的原因，此时未运行验收
+	Error string `json:"error,omitempty" msgpack:"error"`
+}
@@ -8,11 +8,15 @@ const (
 	ChunkTypeInterface = "Interface" // 接口定义 (Go/TS Interface)
 	ChunkTypeClass     = "Class"     // 类定义 (TS Class)
 	ChunkTypeType      = "Type"      // 通用类型别名
+	ChunkTypeEnum      = "Enum"      // 枚举 (TS enum)
+	ChunkTypeVar       = "Var"       // 包级变量 (Go var)
+	ChunkTypeConst     = "Const"     // 包级常量 (Go const)
+	ChunkTypeHeader    = "Header"    // 文件头: package + imports / TS imports + 'use client' 等指令
 )
 
 // Chunk 代表一个代码原子（函数/结构体/接口）
 type Chunk struct {
-	// 唯一标识符: "filepath:start_byte-end_byte" 或 "filepath:Name"
+	// 唯一标识符: "filepath:pkg.Name" / "filepath:pkg.Recv.Method"，重名追加 "#2" (规则见 chunk_id.go)
 	// msgpack: 数据库存储字段名
 	ID string `json:"id" msgpack:"id"`
 
@@ -31,7 +35,40 @@ type Chunk struct {
 	// 引用表: 调用了什么符号 (用于构建脏链接图)
 	SymbolsReferenced []string `json:"symbols_referenced" msgpack:"symbols_referenced"`
 
+	// 实现表: 该类型实现/继承的接口与基类符号 (Go 由类型检查计算，TS 取 implements/extends)
+	Implements []string `json:"implements" msgpack:"implements"`
+
+	// 导入表: 该 Chunk 用到的 import 语句 (每项为一条独立语句，如 `import lo "github.com/samber/lo"`)
+	// 文件头 Chunk 记录文件的全部 import
+	Imports []string `json:"imports" msgpack:"imports"`
+
 	// 文件元数据: 用于增量更新检查
 	FilePath  string `json:"file_path" msgpack:"file_path"`
 	UpdatedAt int64  `json:"updated_at" msgpack:"updated_at"` // Unix Timestamp
+
+	// 内容哈希: 不含 UpdatedAt 与自身，内容不变时跳过重写
+	ContentHash string `json:"content_hash" msgpack:"content_hash"`
+}
+
+// FileMeta 单个源文件的增量索引记录
+type FileMeta struct {
+	// 文件内容哈希 (xxhash)，不依赖 mtime
+	ContentHash string `json:"content_hash" msgpack:"content_hash"`
+	// 上次索引产出的 ChunkID -> Chunk.ContentHash
+	ChunkHashes map[string]string `json:"chunk_hashes" msgpack:"chunk_hashes"`
+	IndexedAt   int64             `json:"indexed_at" msgpack:"indexed_at"` // Unix Timestamp
+	// 索引结构版本，与当前版本不一致时强制重建
+	Schema int `json:"schema" msgpack:"schema"`
+}
+
+// ChunkEmbedding Chunk 的语义向量，ContentHash 与 Chunk.ContentHash 一致时无需重算
+type ChunkEmbedding struct {
+	ContentHash string    `json:"content_hash" msgpack:"content_hash"`
+	Vector      []float32 `json:"vector" msgpack:"vector"`
+}
+
+// ChunkTerms Chunk 的词法索引 (BM25 词频)
+type ChunkTerms struct {
+	Terms  map[string]int `json:"terms" msgpack:"terms"`
+	Length int            `json:"length" msgpack:"length"`
 }
@@ -0,0 +1,93 @@
+package models
+
+// 依赖扩散中纳入某个 Chunk 的原因
+const (
+	TraceReasonCaller         = "caller"         // 契约变更时并入 Core 的调用方
+	TraceReasonDependency     = "dependency"     // 按引用关系扩散
+	TraceReasonHostStruct     = "host_struct"    // Core 方法的宿主类型
+	TraceReasonImplementation = "implementation" // 接口与实现的补全
+)
+
+// 负选择阶段对扩散结果的裁决
+const (
+	TraceVerdictAutoKeep = "auto_keep" // 直接依赖的类型，保留 Body
+	TraceVerdictKept     = "kept"      // 负选择 Agent 保留 Body
+	TraceVerdictPruned   = "pruned"    // 负选择 Agent 未选中，降级为 Skeleton
+	TraceVerdictDeepType = "deep_type" // 第 2 跳及更远的类型，降级为 Skeleton
+)
+
+// TraceTierDropped 打包阶段因预算不足未放入上下文的 Chunk
+const TraceTierDropped = "dropped"
+
+// SelectionTrace 一次 SelectRelevantChunks 的决策记录，用于事后排查某个 Chunk 为何入选或落选
+type SelectionTrace struct {
+	RunID     string `json:"run_id" msgpack:"run_id"`
+	Intent    string `json:"intent" msgpack:"intent"`
+	Model     string `json:"model" msgpack:"model"`
+	CreatedAt int64  `json:"created_at" msgpack:"created_at"` // Unix Timestamp
+	// 选择中途失败时的错误信息
+	Error string `json:"error,omitempty" msgpack:"error"`
+
+	// L1 候选: 预排序后的 ChunkID，CandidatePool 为截断前的候选总数
+	Candidates    []string `json:"candidates" msgpack:"candidates"`
+	CandidatePool int      `json:"candidate_pool" msgpack:"candidate_pool"`
+	// Shards: L1 分片数 (1 表示未分片)
+	Shards int `json:"shards" msgpack:"shards"`
+
+	CoreIDs        []string `json:"core_ids" msgpack:"core_ids"`
+	ContractChange bool     `json:"contract_change" msgpack:"contract_change"`
+
+	// Expanded: 扩散纳入的 ChunkID -> 原因 (TraceReason*)，同一 Chunk 只记录首个原因
+	Expanded map[string]string `json:"expanded" msgpack:"expanded"`
+	// Verdicts: 扩散结果的裁决 (TraceVerdict*)
+	Verdicts map[string]string `json:"verdicts" msgpack:"verdicts"`
+	// Tiers: 打包阶段为每个 Chunk 选择的呈现级别 ("full"、"doc_only" 等，预算不足时为 TraceTierDropped)
+	Tiers map[string]string `json:"tiers" msgpack:"tiers"`
+	// Files: 各文件的命中密度与是否升格
+	Files map[string]*TraceFileDensity `json:"files" msgpack:"files"`
+
+	Tokens TraceTokens `json:"tokens" msgpack:"tokens"`
+}
+
+// TraceFileDensity 文件的 Body 命中 Token / 全部 Chunk 的 Token
+type TraceFileDensity struct {
+	Selected int     `json:"selected" msgpack:"selected"`
+	Total    int     `json:"total" msgpack:"total"`
+	Density  float64 `json:"density" msgpack:"density"`
+	Promoted bool    `json:"promoted" msgpack:"promoted"`
+}
+
+// TraceTokens 各部分的 Token (按选择模型的词表计数)
+type TraceTokens struct {
+	Candidates int `json:"candidates" msgpack:"candidates"`
+	Bodies     int `json:"bodies" msgpack:"bodies"`       // 完整呈现的 Chunk
+	Compacted  int `json:"compacted" msgpack:"compacted"` // 精简呈现的 Chunk 与文件头
+	FullFiles  int `json:"full_files" msgpack:"full_files"`
+}
+
+// Total 最终上下文的估算 Token
+func (t TraceTokens) Total() int {
+	return t.Bodies + t.Compacted + t.FullFiles
+}
+
+// AddExpansion 记录扩散纳入的 Chunk，已有原因的保持不变
+func (t *SelectionTrace) AddExpansion(reason string, ids ...string) {
+	if t.Expanded == nil {
+		t.Expanded = make(map[string]string)
+	}
+	for _, id := range ids {
+		if _, ok := t.Expanded[id]; !ok {
+			t.Expanded[id] = reason
+		}
+	}
+}
+
+// SetVerdict 记录一组 Chunk 的裁决
+func (t *SelectionTrace) SetVerdict(verdict string, ids ...string) {
+	if t.Verdicts == nil {
+		t.Verdicts = make(map[string]string)
+	}
+	for _, id := range ids {
+		t.Verdicts[id] = verdict
+	}
+}
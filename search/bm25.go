@@ -0,0 +1,77 @@
+package search
+
+import "math"
+
+// BM25 参数 (Okapi BM25 常用取值)
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// Document 词法索引中的单个文档
+type Document struct {
+	ID     string
+	Terms  map[string]int // 词 -> 词频
+	Length int            // 总词数
+}
+
+// NewDocument 对文本分词并统计词频
+func NewDocument(id, text string) Document {
+	tokens := Tokenize(text)
+	terms := make(map[string]int, len(tokens))
+	for _, t := range tokens {
+		terms[t]++
+	}
+	return Document{ID: id, Terms: terms, Length: len(tokens)}
+}
+
+// BM25Index 内存中的 BM25 索引
+type BM25Index struct {
+	docs   []Document
+	df     map[string]int // 词 -> 包含该词的文档数
+	avgLen float64
+}
+
+func NewBM25Index(docs []Document) *BM25Index {
+	idx := &BM25Index{docs: docs, df: make(map[string]int)}
+	total := 0
+	for _, d := range docs {
+		total += d.Length
+		for term := range d.Terms {
+			idx.df[term]++
+		}
+	}
+	if len(docs) > 0 {
+		idx.avgLen = float64(total) / float64(len(docs))
+	}
+	return idx
+}
+
+// Rank 按 BM25 得分降序返回命中文档 (得分为 0 的不返回)
+func (idx *BM25Index) Rank(query string) []Scored {
+	queryTerms := make(map[string]bool)
+	for _, t := range Tokenize(query) {
+		queryTerms[t] = true
+	}
+
+	n := float64(len(idx.docs))
+	var ranked []Scored
+	for _, d := range idx.docs {
+		score := 0.0
+		for term := range queryTerms {
+			tf := float64(d.Terms[term])
+			if tf == 0 {
+				continue
+			}
+			df := float64(idx.df[term])
+			idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+			norm := tf + bm25K1*(1-bm25B+bm25B*float64(d.Length)/math.Max(idx.avgLen, 1))
+			score += idf * tf * (bm25K1 + 1) / norm
+		}
+		if score > 0 {
+			ranked = append(ranked, Scored{ID: d.ID, Score: score})
+		}
+	}
+	sortScored(ranked)
+	return ranked
+}
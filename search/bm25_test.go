@@ -0,0 +1,87 @@
+package search
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestNewDocument(t *testing.T) {
+	doc := NewDocument("a", "SaveUser saves the user")
+	want := map[string]int{"saveuser": 1, "save": 1, "user": 2, "saves": 1}
+	if !reflect.DeepEqual(doc.Terms, want) || doc.Length != 5 {
+		t.Errorf("NewDocument = %v (length %d), want %v (length 5)", doc.Terms, doc.Length, want)
+	}
+}
+
+func TestBM25Rank(t *testing.T) {
+	tests := []struct {
+		name  string
+		docs  map[string]string
+		query string
+		want  []string
+	}{
+		{
+			name:  "no match",
+			docs:  map[string]string{"a": "load config", "b": "parse file"},
+			query: "render",
+			want:  nil,
+		},
+		{
+			name:  "only matching documents are returned",
+			docs:  map[string]string{"a": "save user", "b": "load config"},
+			query: "save",
+			want:  []string{"a"},
+		},
+		{
+			name:  "rare term outweighs common term",
+			docs:  map[string]string{"a": "chunk index", "b": "chunk storage", "c": "chunk embedding"},
+			query: "chunk storage",
+			want:  []string{"b", "a", "c"},
+		},
+		{
+			name:  "higher term frequency ranks first",
+			docs:  map[string]string{"a": "token budget", "b": "token token budget", "c": "other words"},
+			query: "token",
+			want:  []string{"b", "a"},
+		},
+		{
+			name:  "shorter document ranks first at equal frequency",
+			docs:  map[string]string{"a": "rename symbol across references files", "b": "rename symbol", "c": "other words"},
+			query: "rename",
+			want:  []string{"b", "a"},
+		},
+		{
+			name:  "camelCase query matches split terms",
+			docs:  map[string]string{"a": "apply the modification", "b": "apply patch"},
+			query: "ApplyModification",
+			want:  []string{"a", "b"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var docs []Document
+			for id, text := range tt.docs {
+				docs = append(docs, NewDocument(id, text))
+			}
+			var got []string
+			for _, hit := range NewBM25Index(docs).Rank(tt.query) {
+				got = append(got, hit.ID)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Rank(%q) = %v, want %v", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBM25Score(t *testing.T) {
+	// 单文档单词: idf = ln(1 + 0.5/1.5)，长度等于平均长度时 tf 部分为 1
+	ranked := NewBM25Index([]Document{NewDocument("a", "save")}).Rank("save save")
+	if len(ranked) != 1 || math.Abs(ranked[0].Score-math.Log(4.0/3)) > 1e-9 {
+		t.Errorf("Rank = %v, want a single hit scored ln(4/3)", ranked)
+	}
+	if got := NewBM25Index(nil).Rank("save"); len(got) != 0 {
+		t.Errorf("empty index Rank = %v, want none", got)
+	}
+}
@@ -0,0 +1,22 @@
+package search
+
+// rrfK RRF 平滑常数，60 为论文推荐值
+const rrfK = 60
+
+// ReciprocalRankFusion 融合多路排序: score(d) = Σ 1 / (rrfK + rank_i(d))
+// 只看名次不看原始分数，余弦相似度与 BM25 分数无需归一化
+func ReciprocalRankFusion(rankings ...[]Scored) []Scored {
+	scores := make(map[string]float64)
+	for _, ranking := range rankings {
+		for rank, hit := range ranking {
+			scores[hit.ID] += 1.0 / float64(rrfK+rank+1)
+		}
+	}
+
+	fused := make([]Scored, 0, len(scores))
+	for id, score := range scores {
+		fused = append(fused, Scored{ID: id, Score: score})
+	}
+	sortScored(fused)
+	return fused
+}
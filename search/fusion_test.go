@@ -0,0 +1,53 @@
+package search
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestReciprocalRankFusion(t *testing.T) {
+	ranking := func(ids ...string) []Scored {
+		scored := make([]Scored, len(ids))
+		for i, id := range ids {
+			scored[i] = Scored{ID: id, Score: float64(len(ids) - i)}
+		}
+		return scored
+	}
+
+	tests := []struct {
+		name     string
+		rankings [][]Scored
+		want     []string
+	}{
+		{"no rankings", nil, nil},
+		{"single ranking keeps order", [][]Scored{ranking("b", "a", "c")}, []string{"b", "a", "c"}},
+		{"hit in both rankings beats top of one", [][]Scored{ranking("a", "b"), ranking("c", "b")}, []string{"b", "a", "c"}},
+		{"same ranks tie-break by ID", [][]Scored{ranking("y", "x"), ranking("x", "y")}, []string{"x", "y"}},
+		{"raw scores are ignored", [][]Scored{{{ID: "a", Score: 1000}, {ID: "b", Score: 999}}, {{ID: "b", Score: 0.2}, {ID: "c", Score: 0.1}}}, []string{"b", "a", "c"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, hit := range ReciprocalRankFusion(tt.rankings...) {
+				got = append(got, hit.ID)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ReciprocalRankFusion = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReciprocalRankFusionScore(t *testing.T) {
+	fused := ReciprocalRankFusion([]Scored{{ID: "a"}, {ID: "b"}}, []Scored{{ID: "b"}})
+	want := map[string]float64{"a": 1.0 / 61, "b": 1.0/62 + 1.0/61}
+	for _, hit := range fused {
+		if math.Abs(hit.Score-want[hit.ID]) > 1e-12 {
+			t.Errorf("score(%s) = %v, want %v", hit.ID, hit.Score, want[hit.ID])
+		}
+	}
+	if len(fused) != len(want) {
+		t.Errorf("fused %d hits, want %d", len(fused), len(want))
+	}
+}
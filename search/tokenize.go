@@ -0,0 +1,92 @@
+package search
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// stopWords 代码与英文中几乎无区分度的词
+var stopWords = map[string]bool{
+	"the": true, "and": true, "for": true, "to": true, "of": true, "in": true, "is": true, "a": true, "an": true,
+	"func": true, "return": true, "if": true, "else": true, "var": true, "const": true, "type": true, "struct": true,
+	"nil": true, "err": true, "error": true, "string": true, "int": true, "bool": true, "function": true, "let": true,
+	"this": true, "new": true, "true": true, "false": true, "null": true, "undefined": true,
+}
+
+// Tokenize 切分文本为检索词 (小写)
+// 标识符按 camelCase / snake_case / 数字边界拆分，同时保留完整标识符:
+// "ApplyModification" -> ["applymodification", "apply", "modification"]
+// 汉字按单字切分
+func Tokenize(text string) []string {
+	var tokens []string
+	var word []rune
+	flush := func() {
+		if len(word) > 0 {
+			tokens = append(tokens, splitIdentifier(string(word))...)
+			word = word[:0]
+		}
+	}
+
+	for _, r := range text {
+		switch {
+		case unicode.Is(unicode.Han, r):
+			flush()
+			tokens = append(tokens, string(r))
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_':
+			word = append(word, r)
+		default:
+			flush()
+		}
+	}
+	flush()
+
+	return filterTokens(tokens)
+}
+
+// splitIdentifier 拆分单个标识符: "parseHTTPResponse_v2" -> ["parsehttpresponse_v2", "parse", "http", "response", "v", "2"]
+func splitIdentifier(ident string) []string {
+	parts := []string{strings.ToLower(ident)}
+	for _, segment := range strings.Split(ident, "_") {
+		runes := []rune(segment)
+		start := 0
+		for i := 1; i < len(runes); i++ {
+			prev, cur := runes[i-1], runes[i]
+			boundary := (unicode.IsLower(prev) && unicode.IsUpper(cur)) ||
+				(unicode.IsDigit(prev) != unicode.IsDigit(cur)) ||
+				// 缩写结尾: "HTTPServer" 在 "P|S" 处切分
+				(unicode.IsUpper(prev) && unicode.IsUpper(cur) && i+1 < len(runes) && unicode.IsLower(runes[i+1]))
+			if boundary {
+				parts = append(parts, strings.ToLower(string(runes[start:i])))
+				start = i
+			}
+		}
+		if start < len(runes) {
+			parts = append(parts, strings.ToLower(string(runes[start:])))
+		}
+	}
+	// 单段标识符的拆分结果与完整形式相同，去重
+	if len(parts) == 2 && parts[0] == parts[1] {
+		return parts[:1]
+	}
+	return parts
+}
+
+func filterTokens(tokens []string) []string {
+	result := tokens[:0]
+	for _, t := range tokens {
+		isHan := len([]rune(t)) == 1 && unicode.Is(unicode.Han, []rune(t)[0])
+		if stopWords[t] || (!isHan && len(t) < 2) {
+			continue
+		}
+		result = append(result, t)
+	}
+	return result
+}
+
+var commentPattern = regexp.MustCompile(`//[^\n]*|/\*[\s\S]*?\*/`)
+
+// ExtractComments 提取源码中的行注释与块注释文本
+func ExtractComments(source string) string {
+	return strings.Join(commentPattern.FindAllString(source, -1), "\n")
+}
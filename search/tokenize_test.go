@@ -0,0 +1,42 @@
+package search
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"ApplyModification", []string{"applymodification", "apply", "modification"}},
+		{"chunk_id", []string{"chunk_id", "chunk", "id"}},
+		{"HTTPServer", []string{"httpserver", "http", "server"}},
+		// 单字母与数字片段过滤掉，完整标识符保留
+		{"parseHTTPResponse_v2", []string{"parsehttpresponse_v2", "parse", "http", "response"}},
+		// 单段标识符不重复
+		{"user", []string{"user"}},
+		// 停用词与标点
+		{"func (u *User) Save() error {", []string{"user", "save"}},
+		{"保存用户", []string{"保", "存", "用", "户"}},
+		{"x = 1", nil},
+	}
+	for _, tt := range tests {
+		got := Tokenize(tt.text)
+		if len(got) == 0 && len(tt.want) == 0 {
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Tokenize(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestExtractComments(t *testing.T) {
+	source := "// Save 保存\nfunc Save() { /* inline */ x := \"a\" }\n"
+	want := "// Save 保存\n/* inline */"
+	if got := ExtractComments(source); got != want {
+		t.Errorf("ExtractComments = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,59 @@
+package search
+
+import (
+	"math"
+	"sort"
+)
+
+// Scored 单条检索结果
+type Scored struct {
+	ID    string
+	Score float64
+}
+
+// CosineSimilarity 余弦相似度；维度不一致或零向量时返回 0
+func CosineSimilarity(a, b []float32) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
+
+// RankByVector 按与 query 的余弦相似度降序排列 (同分按 ID)，维度不一致的向量跳过
+func RankByVector(query []float32, vectors map[string][]float32) []Scored {
+	ranked := make([]Scored, 0, len(vectors))
+	for id, vector := range vectors {
+		if len(vector) != len(query) {
+			continue
+		}
+		ranked = append(ranked, Scored{ID: id, Score: CosineSimilarity(query, vector)})
+	}
+	sortScored(ranked)
+	return ranked
+}
+
+// TopK 截取前 k 条；k <= 0 时不截断
+func TopK(ranked []Scored, k int) []Scored {
+	if k <= 0 || len(ranked) <= k {
+		return ranked
+	}
+	return ranked[:k]
+}
+
+func sortScored(ranked []Scored) {
+	sort.Slice(ranked, func(i, j int) bool {
+		if ranked[i].Score != ranked[j].Score {
+			return ranked[i].Score > ranked[j].Score
+		}
+		return ranked[i].ID < ranked[j].ID
+	})
+}
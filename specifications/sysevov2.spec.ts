@@ -42,9 +42,9 @@ export interface Chunk {
  * 云端 LLM 输出的原子操作，严禁使用行号。
  */
 export interface CodeModification {
-    target_chunk_id: string;
-    action_type: 'MODIFY' | 'DELETE' | 'CREATE_FILE';
-    new_content: string; // Valid AST Node
+    target_chunk_id: string; // INSERT_BEFORE / INSERT_AFTER 时为锚点
+    action_type: 'MODIFY' | 'DELETE' | 'CREATE_FILE' | 'INSERT_BEFORE' | 'INSERT_AFTER' | 'RENAME_SYMBOL' | 'APPEND';
+    new_content: string; // Valid AST Node；RENAME_SYMBOL 时为新名称
     reasoning: string;
 }
 
@@ -23,8 +23,8 @@ type Chunk struct {
 type CodeModification struct {
 	FilePath      string `json:"file_path"`
 	TargetChunkID string `json:"target_chunk_id" description:"The anchor ID. For new files, use 'EOF'"`
-	ActionType    string `json:"action_type" description:"'MODIFY' | 'DELETE' | 'CREATE_FILE'"`
-	NewContent    string `json:"new_content" description:"Complete new AST node content (Header + Body)"`
+	ActionType    string `json:"action_type" description:"'MODIFY' | 'DELETE' | 'CREATE_FILE' | 'INSERT_BEFORE' | 'INSERT_AFTER' | 'RENAME_SYMBOL' | 'APPEND'"`
+	NewContent    string `json:"new_content" description:"Complete new AST node content (Header + Body); the new identifier for RENAME_SYMBOL"`
 	Reasoning     string `json:"reasoning" description:"Chain of Thought explanation"`
 }
 
@@ -0,0 +1,34 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/doptime/config/cfgredis"
+)
+
+// DeleteChunks 从 ChunkStorage 中删除指定 Chunk 及其语义向量、词法索引
+func DeleteChunks(chunkIDs ...string) error {
+	for _, key := range []string{chunkStorageKey, chunkEmbeddingKey, chunkTermsKey} {
+		if err := hdel(key, chunkIDs...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteFileRecords 删除文件的增量元数据
+func DeleteFileRecords(paths ...string) error {
+	return hdel(fileMetaKey, paths...)
+}
+
+func hdel(key string, fields ...string) error {
+	if len(fields) == 0 {
+		return nil
+	}
+	client, ok := cfgredis.Servers.Get("default")
+	if !ok {
+		return fmt.Errorf("redis client not found")
+	}
+	return client.HDel(context.Background(), key, fields...).Err()
+}
@@ -9,31 +9,90 @@ import (
 )
 
 // DirtyIndexClient 负责管理符号到 Chunk 的反向索引
-// Key Schema: sys/idx/sym/{symbol} -> Set(ChunkIDs)
+// Key Schema:
+//   - sys/idx/sym/{symbol} -> Set(ChunkIDs)  定义该符号的 Chunk
+//   - sys/idx/ref/{symbol} -> Set(ChunkIDs)  引用该符号的 Chunk (调用方)
+//   - sys/idx/impl/{symbol} -> Set(ChunkIDs) 实现/继承该接口或基类的 Chunk
 type DirtyIndexClient struct{}
 
 var Indexer = &DirtyIndexClient{}
 
-// AddSymbolLink 建立链接: Symbol -> ChunkID
-func (c *DirtyIndexClient) AddSymbolLink(symbol string, chunkID string) error {
+func symbolKey(symbol string) string {
 	// Key 分隔符使用 "/"
-	key := fmt.Sprintf("sys/idx/sym/%s", symbol)
+	return fmt.Sprintf("sys/idx/sym/%s", symbol)
+}
+
+func referenceKey(symbol string) string {
+	return fmt.Sprintf("sys/idx/ref/%s", symbol)
+}
+
+func implementsKey(symbol string) string {
+	return fmt.Sprintf("sys/idx/impl/%s", symbol)
+}
 
+// AddSymbolLink 建立链接: Symbol -> ChunkID
+func (c *DirtyIndexClient) AddSymbolLink(symbol string, chunkID string) error {
 	// NewSetKey 必须指定两个泛型 [k, v]，这里都是 string
 	// SAdd 返回 error
-	return redisdb.NewSetKey[string, string](redisdb.WithKey(key)).SAdd(chunkID)
+	return redisdb.NewSetKey[string, string](redisdb.WithKey(symbolKey(symbol))).SAdd(chunkID)
+}
+
+// RemoveSymbolLink 删除链接: Symbol -> ChunkID (Chunk 被删除或不再定义该符号时调用)
+func (c *DirtyIndexClient) RemoveSymbolLink(symbol string, chunkID string) error {
+	return srem(symbolKey(symbol), chunkID)
+}
+
+// AddReferenceLink 建立反向引用: 被引用的 Symbol -> 引用方 ChunkID
+func (c *DirtyIndexClient) AddReferenceLink(symbol string, chunkID string) error {
+	return redisdb.NewSetKey[string, string](redisdb.WithKey(referenceKey(symbol))).SAdd(chunkID)
+}
+
+// RemoveReferenceLink 删除反向引用 (Chunk 被删除或不再引用该符号时调用)
+func (c *DirtyIndexClient) RemoveReferenceLink(symbol string, chunkID string) error {
+	return srem(referenceKey(symbol), chunkID)
+}
+
+// GetReferrers 使用 SUNION 获取引用了任一符号的 ChunkID (去重)
+func (c *DirtyIndexClient) GetReferrers(symbols []string) ([]string, error) {
+	return sunion(symbols, referenceKey)
+}
+
+// AddImplementsLink 建立实现关系: 接口/基类 Symbol -> 实现方 ChunkID
+func (c *DirtyIndexClient) AddImplementsLink(symbol string, chunkID string) error {
+	return redisdb.NewSetKey[string, string](redisdb.WithKey(implementsKey(symbol))).SAdd(chunkID)
+}
+
+// RemoveImplementsLink 删除实现关系 (Chunk 被删除或不再实现该接口时调用)
+func (c *DirtyIndexClient) RemoveImplementsLink(symbol string, chunkID string) error {
+	return srem(implementsKey(symbol), chunkID)
+}
+
+// GetImplementers 使用 SUNION 获取实现/继承了任一符号的 ChunkID (去重)
+func (c *DirtyIndexClient) GetImplementers(symbols []string) ([]string, error) {
+	return sunion(symbols, implementsKey)
+}
+
+func srem(key string, member string) error {
+	client, ok := cfgredis.Servers.Get("default")
+	if !ok {
+		return fmt.Errorf("redis client not found")
+	}
+	return client.SRem(context.Background(), key, member).Err()
 }
 
 // GetSymbolLinks 查找链接: Symbol -> [ChunkID, ChunkID...]
 func (c *DirtyIndexClient) GetSymbolLinks(symbol string) ([]string, error) {
-	key := fmt.Sprintf("sys/idx/sym/%s", symbol)
-
 	// SMembers 返回 []v, error
-	return redisdb.NewSetKey[string, string](redisdb.WithKey(key)).SMembers()
+	return redisdb.NewSetKey[string, string](redisdb.WithKey(symbolKey(symbol))).SMembers()
 }
 
 // GetUnionLinks 使用 SUNION 一次性获取所有符号对应的 ChunkID 并去重
 func (c *DirtyIndexClient) GetUnionLinks(symbols []string) ([]string, error) {
+	return sunion(symbols, symbolKey)
+}
+
+// sunion 对每个符号按 keyOf 构造 Set Key 后执行 SUNION
+func sunion(symbols []string, keyOf func(string) string) ([]string, error) {
 	if len(symbols) == 0 {
 		return []string{}, nil
 	}
@@ -42,7 +101,7 @@ func (c *DirtyIndexClient) GetUnionLinks(symbols []string) ([]string, error) {
 	keys := make([]string, len(symbols))
 	for i, sym := range symbols {
 		// FIX: 确保前缀匹配 README (sys/idx/sym/)
-		keys[i] = fmt.Sprintf("sys/idx/sym/%s", sym)
+		keys[i] = keyOf(sym)
 	}
 
 	// 2. 调用 Redis SUNION 命令
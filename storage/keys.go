@@ -10,13 +10,54 @@ import (
 // Key: sysevo/chunks
 // Field: ChunkID
 var ChunkStorage = redisdb.NewHashKey[string, *models.Chunk](
-	redisdb.WithKey("sysevo/chunks"),
+	redisdb.WithKey(chunkStorageKey),
 )
 
-// FileMetaKey: 增量检查辅助 Key
-// Key: sysevo/files/meta
+// FileMetaKey: 增量检查辅助 Key (内容哈希 + 上次产出的 Chunk 哈希)
+// Key: sysevo/files/index
 // Field: FilePath
-// Value: LastModifiedUnix
-var FileMetaKey = redisdb.NewHashKey[string, int64](
-	redisdb.WithKey("sysevo/files/meta"),
+// Value: *models.FileMeta
+var FileMetaKey = redisdb.NewHashKey[string, *models.FileMeta](
+	redisdb.WithKey(fileMetaKey),
+)
+
+// ChunkEmbeddingKey: Chunk 语义向量 (L1 候选预排序)
+// Key: sysevo/embeddings
+// Field: ChunkID
+// Value: *models.ChunkEmbedding
+var ChunkEmbeddingKey = redisdb.NewHashKey[string, *models.ChunkEmbedding](
+	redisdb.WithKey(chunkEmbeddingKey),
+)
+
+// ChunkTermsKey: Chunk 词法索引 (BM25 词频)，随 Chunk 重写
+// Key: sysevo/terms
+// Field: ChunkID
+// Value: *models.ChunkTerms
+var ChunkTermsKey = redisdb.NewHashKey[string, *models.ChunkTerms](
+	redisdb.WithKey(chunkTermsKey),
+)
+
+// SelectionTraceKey: 上下文选择的决策记录
+// Key: sysevo/traces
+// Field: RunID
+// Value: *models.SelectionTrace
+var SelectionTraceKey = redisdb.NewHashKey[string, *models.SelectionTrace](
+	redisdb.WithKey(selectionTraceKey),
+)
+
+// GoalRunKey: 带验收条件的目标执行记录 (每轮修改与测试结果)
+// Key: sysevo/goalruns
+// Field: RunID
+// Value: *models.GoalRun
+var GoalRunKey = redisdb.NewHashKey[string, *models.GoalRun](
+	redisdb.WithKey(goalRunKey),
+)
+
+const (
+	chunkStorageKey   = "sysevo/chunks"
+	fileMetaKey       = "sysevo/files/index"
+	chunkEmbeddingKey = "sysevo/embeddings"
+	chunkTermsKey     = "sysevo/terms"
+	selectionTraceKey = "sysevo/traces"
+	goalRunKey        = "sysevo/goalruns"
 )
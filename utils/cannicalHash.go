@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"math/big"
+	"strconv"
 	"time"
 
 	"github.com/cespare/xxhash/v2"
@@ -36,6 +37,11 @@ func toCanonicalMap(val interface{}) (interface{}, error) {
 	return tmp, nil
 }
 
+// ContentHash 计算原始字节的 xxhash，返回 16 进制字符串
+func ContentHash(data []byte) string {
+	return strconv.FormatUint(xxhash.Sum64(data), 16)
+}
+
 func ID(v interface{}, Idlength ...int) string {
 	IdLen := append(Idlength, 6)[0]
 	var inputString string
@@ -1,14 +1,21 @@
 package utils
 
+// maxGitDiffs 每个文件保留的差异历史条数
+const maxGitDiffs = 200
+
 type GitDiffs struct {
 	Diffs []string `toml:"Diffs"`
 }
 
+// AppendGitDiff 将 diff 插入历史最前 (最新在前)
 func AppendGitDiff(gitdiffFile string, diff string) error {
 	OldDiffs, newDiffs := GitDiffs{}, GitDiffs{Diffs: []string{diff}}
 	FromTomlFile(gitdiffFile, &OldDiffs)
 	newDiffs.Diffs = append(newDiffs.Diffs, OldDiffs.Diffs...)
-	return ToTomlFile(gitdiffFile, diff)
+	if len(newDiffs.Diffs) > maxGitDiffs {
+		newDiffs.Diffs = newDiffs.Diffs[:maxGitDiffs]
+	}
+	return ToTomlFile(gitdiffFile, newDiffs)
 }
 func UpdateLatestGitDiff(gitdiffFile string, latestDiff string) error {
 	OldDiffs := GitDiffs{}
@@ -18,8 +25,8 @@ func UpdateLatestGitDiff(gitdiffFile string, latestDiff string) error {
 	}
 
 	//key 200 item  max
-	if len(OldDiffs.Diffs) > 200 {
-		OldDiffs.Diffs = OldDiffs.Diffs[:200]
+	if len(OldDiffs.Diffs) > maxGitDiffs {
+		OldDiffs.Diffs = OldDiffs.Diffs[:maxGitDiffs]
 	}
 	return ToTomlFile(gitdiffFile, OldDiffs)
 }
@@ -8,7 +8,7 @@ import (
 )
 
 func FromTomlFile(filePath string, structPtr interface{}) (err error) {
-	_, err = toml.DecodeFile(filePath, &structPtr)
+	_, err = toml.DecodeFile(filePath, structPtr)
 	return err
 }
 func ToTomlFile(filePath string, structPtr interface{}) error {
@@ -0,0 +1,317 @@
+package workflow
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"sysevov2/agent"
+	"sysevov2/config"
+	"sysevov2/context"
+	"sysevov2/editing"
+	"sysevov2/llm"
+	"sysevov2/models"
+	"sysevov2/storage"
+	"sysevov2/utils"
+
+	"github.com/samber/lo"
+)
+
+// defaultAcceptanceRounds 验收失败后默认让编辑模型继续修改的轮数
+const defaultAcceptanceRounds = 3
+
+// acceptanceOutputLimit 记录与提示中保留的验收输出尾部字节数
+const acceptanceOutputLimit = 8000
+
+// Acceptance 目标的验收条件
+// Command 非空时以命令的退出码判定；否则对受影响的 Go 包运行 go test，Tests 为顶层测试名 (为空时运行全部测试)
+type Acceptance struct {
+	Command   string
+	Tests     []string
+	MaxRounds int
+}
+
+func (a *Acceptance) String() string {
+	if a.Command != "" {
+		return a.Command
+	}
+	if len(a.Tests) == 0 {
+		return "go test"
+	}
+	return "go test -run '" + a.runPattern() + "'"
+}
+
+func (a *Acceptance) runPattern() string {
+	return "^(" + strings.Join(a.Tests, "|") + ")$"
+}
+
+// acceptanceResult 一次验收的结果
+type acceptanceResult struct {
+	passed   bool
+	failures []string // 失败的顶层测试名
+	output   string   // 去掉 RUN/PASS 行后的输出尾部
+	duration time.Duration
+}
+
+// score 失败程度，越小越好；构建失败等无法归因到测试的失败记为最差
+func (res *acceptanceResult) score() int {
+	switch {
+	case res.passed:
+		return 0
+	case len(res.failures) > 0:
+		return len(res.failures)
+	default:
+		return math.MaxInt
+	}
+}
+
+// failedTestLine go test -v 的失败行: "--- FAIL: TestSave (0.00s)"，子测试带缩进与 "/"
+var failedTestLine = regexp.MustCompile(`^\s*--- FAIL: ([^\s/]+)`)
+
+// run 在 paths 所属的模块中执行验收
+func (a *Acceptance) run(paths []string) (*acceptanceResult, error) {
+	start := time.Now()
+	var cmds []*exec.Cmd
+	if a.Command != "" {
+		dir, err := acceptanceDir(paths)
+		if err != nil {
+			return nil, err
+		}
+		cmd := exec.Command("sh", "-c", a.Command)
+		cmd.Dir = dir
+		cmds = append(cmds, cmd)
+	} else {
+		byModule, err := editing.GoPackagePatterns(paths)
+		if err != nil {
+			return nil, err
+		}
+		if len(byModule) == 0 {
+			return nil, fmt.Errorf("no Go packages affected, nothing to test")
+		}
+		for root, patterns := range byModule {
+			args := []string{"test", "-count=1", "-v"}
+			if len(a.Tests) > 0 {
+				args = append(args, "-run", a.runPattern())
+			}
+			cmd := exec.Command("go", append(args, patterns...)...)
+			cmd.Dir = root
+			cmds = append(cmds, cmd)
+		}
+	}
+
+	res := &acceptanceResult{passed: true}
+	ran := false
+	var output strings.Builder
+	for _, cmd := range cmds {
+		out, err := cmd.CombinedOutput()
+		var exitErr *exec.ExitError
+		if err != nil && !errors.As(err, &exitErr) {
+			return nil, fmt.Errorf("run %s: %w", a, err)
+		}
+		if err != nil {
+			res.passed = false
+		}
+		for _, line := range strings.Split(string(out), "\n") {
+			if m := failedTestLine.FindStringSubmatch(line); m != nil {
+				res.failures = append(res.failures, m[1])
+			}
+			trimmed := strings.TrimSpace(line)
+			ran = ran || strings.HasPrefix(trimmed, "=== RUN")
+			if strings.HasPrefix(trimmed, "=== ") || strings.HasPrefix(trimmed, "--- PASS") {
+				continue
+			}
+			output.WriteString(line + "\n")
+		}
+	}
+	res.failures = lo.Uniq(res.failures)
+
+	// 指定的测试一个都没有运行时 go test 仍然成功，视为未通过
+	if res.passed && a.Command == "" && len(a.Tests) > 0 && !ran {
+		res.passed = false
+		fmt.Fprintf(&output, "none of the acceptance tests %v exist in the affected packages\n", a.Tests)
+	}
+	res.output = tail(output.String(), acceptanceOutputLimit)
+	res.duration = time.Since(start)
+	return res, nil
+}
+
+func tail(s string, limit int) string {
+	if len(s) <= limit {
+		return s
+	}
+	return "...\n" + s[len(s)-limit:]
+}
+
+// acceptanceDir 命令验收的工作目录: 首个属于 Realm 的受影响文件取 Realm 根目录，
+// 均不属于任何 Realm 时取首个受影响文件所属 Go 模块的根目录，两者都找不到时报错
+func acceptanceDir(paths []string) (string, error) {
+	for _, path := range paths {
+		if realm := config.RealmOf(path); realm != nil {
+			return realm.RootPath, nil
+		}
+	}
+	for _, path := range paths {
+		if root := editing.GoModuleRoot(path); root != "" {
+			return root, nil
+		}
+	}
+	return "", fmt.Errorf("no realm or Go module contains the affected files %v, cannot choose a working directory for the acceptance command", paths)
+}
+
+// runAcceptance 运行验收，失败时附上输出让编辑模型继续修改，直到通过或用尽 Acceptance.MaxRounds
+// 通过时保留全部修改；始终未通过时保留失败测试最少的一轮，其后各轮按逆序回滚 (构建即失败的轮次不会被保留)
+// 每轮结果写入 GoalRun 记录，Field 为本次上下文选择的 RunID
+func (r *GoalRunner) runAcceptance(runID, goal string, model *llm.Model, sol *models.Solution, applied appliedEdits) error {
+	record := &models.GoalRun{RunID: runID, Goal: goal, Acceptance: r.Acceptance.String(), CreatedAt: time.Now().Unix(), BestRound: -1}
+	// attempts[i]: 第 i 轮落盘的变更集，该轮方案未能应用时为 nil
+	attempts := []appliedEdits{applied}
+	mods := append([]*models.CodeModification{}, sol.Modifications...)
+	best, bestScore := -1, math.MaxInt
+	var last *acceptanceResult
+
+	for round := 0; ; round++ {
+		modCount := len(sol.Modifications)
+		if round > 0 {
+			fix := models.NewSolution()
+			edits, err := r.proposeAcceptanceFix(goal, model, fix, last, mods, allPaths(attempts))
+			if err == nil && edits == nil {
+				err = fmt.Errorf("no modifications applied")
+			}
+			attempts = append(attempts, edits)
+			if err != nil {
+				fmt.Printf("❌ Acceptance round %d: %v\n", round, err)
+				record.Rounds = append(record.Rounds, &models.AcceptanceRound{Round: round, Modifications: len(fix.Modifications), Error: err.Error()})
+				saveGoalRun(record)
+				if round >= r.Acceptance.MaxRounds {
+					break
+				}
+				continue
+			}
+			mods = append(mods, fix.Modifications...)
+			modCount = len(fix.Modifications)
+		}
+
+		res, err := r.Acceptance.run(allPaths(attempts))
+		if err != nil {
+			record.Error = err.Error()
+			saveGoalRun(record)
+			return fmt.Errorf("acceptance could not run, edits kept: %w", err)
+		}
+		record.Rounds = append(record.Rounds, &models.AcceptanceRound{
+			Round:         round,
+			Modifications: modCount,
+			Files:         attempts[round].paths(),
+			Passed:        res.passed,
+			Failures:      res.failures,
+			Output:        res.output,
+			DurationMs:    res.duration.Milliseconds(),
+		})
+		if res.passed {
+			record.Passed, record.BestRound = true, round
+			saveGoalRun(record)
+			fmt.Printf("✅ Acceptance passed in round %d: %s\n", round, r.Acceptance)
+			return nil
+		}
+		fmt.Printf("🔍 Acceptance failed in round %d: %d failing tests %v\n", round, len(res.failures), res.failures)
+		saveGoalRun(record)
+		if score := res.score(); score < bestScore {
+			best, bestScore = round, score
+		}
+		last = res
+		if round >= r.Acceptance.MaxRounds {
+			break
+		}
+	}
+
+	for i := len(attempts) - 1; i > best; i-- {
+		if attempts[i] != nil {
+			attempts[i].rollback()
+		}
+	}
+	record.BestRound = best
+	record.Error = fmt.Sprintf("acceptance %q still failing after %d rounds", r.Acceptance, len(record.Rounds))
+	saveGoalRun(record)
+	if best < 0 {
+		return fmt.Errorf("%s, all edits reverted", record.Error)
+	}
+	return fmt.Errorf("%s, kept round %d", record.Error, best)
+}
+
+// proposeAcceptanceFix 让编辑模型根据验收输出继续修改，并像首轮方案一样应用与编译校验
+func (r *GoalRunner) proposeAcceptanceFix(goal string, model *llm.Model, sol *models.Solution, failed *acceptanceResult, mods []*models.CodeModification, paths []string) (appliedEdits, error) {
+	fixGoal := fmt.Sprintf("%s\n\nYour edits for this goal have been applied, but the acceptance check `%s` fails. "+
+		"Modify the code so that it passes. The tests define the expected behavior: do not modify, weaken or delete them.\n"+
+		"<AcceptanceOutput>\n%s</AcceptanceOutput>", goal, r.Acceptance, failed.output)
+	err := r.EditorAgent.Clone().UseTools(LLMToolApplyModification(sol)).Call(map[string]any{
+		agent.UseModel: model,
+		"Goal":         fixGoal,
+		"Context":      acceptanceContext(mods, failed.failures, paths),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return r.applyVerified(fixGoal, model, sol)
+}
+
+// acceptanceContext 已修改的 Chunk (新建的文件整体呈现) 以当前源码呈现，失败的测试函数作为只读参考
+func acceptanceContext(mods []*models.CodeModification, failures []string, paths []string) string {
+	var sb strings.Builder
+	seen := make(map[string]bool)
+	for _, mod := range mods {
+		if mod.ActionType == models.ActionCreateFile || mod.TargetChunkID == "" {
+			if !seen[mod.FilePath] {
+				seen[mod.FilePath] = true
+				if content := utils.ReadFile(mod.FilePath); len(content) > 0 {
+					fmt.Fprintf(&sb, "<File name=\"%s\"> \n%s </File>\n\n", mod.FilePath, content)
+				}
+			}
+			continue
+		}
+		if seen[mod.TargetChunkID] {
+			continue
+		}
+		seen[mod.TargetChunkID] = true
+		// 已删除的 Chunk 读取失败，跳过
+		if body, err := editing.ReadChunk(mod.FilePath, mod.TargetChunkID); err == nil {
+			fmt.Fprintf(&sb, "<Chunk id=\"%s\"> \n%s </Chunk>\n\n", mod.TargetChunkID, body)
+		}
+	}
+
+	dirs := lo.Map(paths, func(path string, _ int) string { return filepath.Dir(path) })
+	tests := editing.ReadTestFunctions(dirs, failures)
+	ids := lo.Keys(tests)
+	sort.Strings(ids)
+	for _, id := range ids {
+		fmt.Fprintf(&sb, "<Chunk id=\"%s\"> \n%s\n%s </Chunk>\n\n", id, context.ReadOnlyBanner, tests[id])
+	}
+	return sb.String()
+}
+
+func allPaths(attempts []appliedEdits) []string {
+	var paths []string
+	for _, edits := range attempts {
+		paths = append(paths, edits.paths()...)
+	}
+	return lo.Uniq(paths)
+}
+
+func saveGoalRun(record *models.GoalRun) {
+	if _, err := storage.GoalRunKey.HSet(record.RunID, record); err != nil {
+		fmt.Printf("⚠️ Failed to save goal run %s: %v\n", record.RunID, err)
+	}
+}
+
+// LoadGoalRun 按 RunID 读取目标执行记录
+func LoadGoalRun(runID string) (*models.GoalRun, error) {
+	record, err := storage.GoalRunKey.HGet(runID)
+	if err != nil || record == nil {
+		return nil, fmt.Errorf("goal run not found: %s", runID)
+	}
+	return record, nil
+}
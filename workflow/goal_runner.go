@@ -2,9 +2,12 @@ package workflow
 
 import (
 	"fmt"
+	"sort"
+	"strings"
 	"text/template"
 
 	"sysevov2/agent"
+	"sysevov2/config"
 	"sysevov2/context"
 	"sysevov2/editing"
 	"sysevov2/llm"
@@ -15,6 +18,49 @@ import (
 type GoalRunner struct {
 	Selector    *context.Selector
 	EditorAgent *agent.Agent
+	// DryRun 为 true 时不写文件，只输出方案的统一差异并存入 .evo/ 的 GitDiffs 历史
+	DryRun bool
+	// MaxRepairRounds 编译校验失败后的修复轮数上限 (默认取 config.Verify)，用尽后回滚全部修改
+	MaxRepairRounds int
+	// Acceptance 目标的验收条件；为空时修改通过编译校验即结束
+	Acceptance *Acceptance
+}
+
+func (g *GoalRunner) WithMaxRepairRounds(rounds int) *GoalRunner {
+	g.MaxRepairRounds = rounds
+	return g
+}
+
+// WithAcceptanceTests 以受影响 Go 包中的测试验收 (go test -run)；不传测试名时运行这些包的全部测试
+func (g *GoalRunner) WithAcceptanceTests(tests ...string) *GoalRunner {
+	a := g.acceptance()
+	a.Command, a.Tests = "", tests
+	return g
+}
+
+// WithAcceptanceCommand 以命令的退出码验收 (sh -c，工作目录为受影响文件所属 Realm 的根目录，不属于 Realm 时为所属 Go 模块的根目录)
+func (g *GoalRunner) WithAcceptanceCommand(command string) *GoalRunner {
+	a := g.acceptance()
+	a.Command, a.Tests = command, nil
+	return g
+}
+
+// WithAcceptanceRounds 验收失败后让编辑模型继续修改的轮数上限
+func (g *GoalRunner) WithAcceptanceRounds(rounds int) *GoalRunner {
+	g.acceptance().MaxRounds = rounds
+	return g
+}
+
+func (g *GoalRunner) acceptance() *Acceptance {
+	if g.Acceptance == nil {
+		g.Acceptance = &Acceptance{MaxRounds: defaultAcceptanceRounds}
+	}
+	return g.Acceptance
+}
+
+func (g *GoalRunner) WithDryRun() *GoalRunner {
+	g.DryRun = true
+	return g
 }
 
 func (g *GoalRunner) WithFilesMustInclude(files ...string) *GoalRunner {
@@ -22,13 +68,73 @@ func (g *GoalRunner) WithFilesMustInclude(files ...string) *GoalRunner {
 	return g
 }
 
-var LLMToolApplyModification = llm.NewTool("ApplyModification", "Modify a code chunk", func(mod *models.CodeModification) {
-	if err := editing.ApplyModification(mod); err != nil {
-		fmt.Printf("❌ Edit Failed: %v\n", err)
-	} else {
-		fmt.Printf("✅ Applied: %s\n", mod.TargetChunkID)
+// LLMToolApplyModification 收集一次调用中的全部修改到 sol，调用结束后由 applySolution 整体应用
+func LLMToolApplyModification(sol *models.Solution) llm.ToolInterface {
+	return llm.NewTool("ApplyModification", "Modify a code chunk", func(mod *models.CodeModification) {
+		sol.Modifications = append(sol.Modifications, mod)
+		fmt.Printf("📝 Staged: %s [%s]\n", mod.TargetChunkID, mod.ActionType)
+	})
+}
+
+// applySolution 原子地应用方案，失败时逐条输出原因且不改动任何文件
+func applySolution(sol *models.Solution) (*editing.Changeset, error) {
+	cs, err := stageSolution(sol)
+	if err != nil || cs == nil {
+		return nil, err
+	}
+	if err := commitSolution(sol, cs); err != nil {
+		return nil, err
+	}
+	return cs, nil
+}
+
+// stageSolution 暂存并校验方案，尚不落盘；没有修改时返回 nil
+func stageSolution(sol *models.Solution) (*editing.Changeset, error) {
+	if len(sol.Modifications) == 0 {
+		fmt.Println("⚠️ No modifications proposed")
+		return nil, nil
+	}
+	cs, err := editing.StageSolution(sol)
+	if err != nil {
+		reportSolutionErrors(sol)
+		return nil, err
 	}
-})
+	return cs, nil
+}
+
+// commitSolution 落盘 stageSolution 返回的变更集
+func commitSolution(sol *models.Solution, cs *editing.Changeset) error {
+	if err := editing.CommitSolution(sol, cs); err != nil {
+		reportSolutionErrors(sol)
+		return err
+	}
+	fmt.Printf("✅ Applied %d modifications\n", len(sol.Modifications))
+	return nil
+}
+
+// previewSolution 只计算方案的差异: 输出补丁并追加到各文件的 GitDiffs 历史，不改动源文件
+func previewSolution(sol *models.Solution) (editing.Patch, error) {
+	if len(sol.Modifications) == 0 {
+		fmt.Println("⚠️ No modifications proposed")
+		return nil, nil
+	}
+	patch, err := editing.DryRunSolution(sol)
+	if err != nil {
+		reportSolutionErrors(sol)
+		return nil, err
+	}
+	fmt.Printf("🧾 Dry run: %d modifications, %d files changed\n%s", len(sol.Modifications), len(patch), patch)
+	if err := patch.Save(); err != nil {
+		fmt.Printf("⚠️ %v\n", err)
+	}
+	return patch, nil
+}
+
+func reportSolutionErrors(sol *models.Solution) {
+	for _, e := range sol.Errors {
+		fmt.Printf("❌ Edit Failed: %s [%s]: %s\n", e.TargetChunkID, sol.Modifications[e.Index].ActionType, e.Error)
+	}
+}
 
 func NewRunner() *GoalRunner {
 	// [Upgraded Prompt] 增加了对上下文结构的解释和防御性指令
@@ -48,6 +154,11 @@ The context consists of:
 2. **Read-Only**: Do NOT attempt to implement or modify chunks marked as [READ-ONLY REFERENCE]. They are provided only for context (e.g., to see available methods).
 3. **completeness**: When modifying a Chunk, you must provide the *complete* new AST node content (Header + Body).
 4. **No Hallucination**: Do not use line numbers. Use 'TargetChunkID' strictly from the context.
+5. **Actions**: Choose the ActionType that matches the intent:
+   - MODIFY / DELETE: replace or remove the target chunk.
+   - INSERT_BEFORE / INSERT_AFTER: add a new declaration right next to the target chunk (e.g. a helper next to the function that uses it, or a method next to its siblings). The target chunk itself is left unchanged; NewContent is only the new declaration.
+   - RENAME_SYMBOL: rename the symbol defined by the target chunk; NewContent is only the new identifier. References are updated automatically (Go references are resolved by the type checker). The rename is refused when references cannot be resolved reliably, e.g. a TS method called from outside its class; then edit the declaration and its callers with MODIFY.
+   - CREATE_FILE: a new file with NewContent as its full content. APPEND: add to the end of an existing file (TargetChunkID empty).
 </Rules>
 
 <Context>
@@ -59,11 +170,13 @@ The context consists of:
 </Goal>
 `))
 
-	editor := agent.Create(t).WithToolCallMutextRun().UseTools(LLMToolApplyModification)
+	// ApplyModification 工具在每次调用时绑定新的 Solution (见 ExecuteGoal)
+	editor := agent.Create(t).WithToolCallMutextRun()
 
 	return &GoalRunner{
-		Selector:    context.NewSelector(),
-		EditorAgent: editor,
+		Selector:        context.NewSelector(),
+		EditorAgent:     editor,
+		MaxRepairRounds: config.Verify.MaxRepairRounds,
 	}
 }
 
@@ -74,30 +187,46 @@ func (r *GoalRunner) ExportContextToFile(goal string, contextStr string) {
 }
 
 func (r *GoalRunner) ExecuteGoal(goal string, contextSelectModel, CodeImproveModel *llm.Model) error {
+	// 选择阶段按编辑模型的窗口打包 (扣除必须包含的文件)
+	if CodeImproveModel != nil {
+		mustInclude := CodeImproveModel.CountTokens(utils.WrapFilesInXML("File", r.Selector.FilesMustInclude...))
+		r.Selector.ContextTokenBudget = max(r.contextBudget(goal, CodeImproveModel)-mustInclude, 1)
+	}
+
 	// 1. 获取上下文 (返回的是 SelectedContext 结构体)
 	selectedCtx, err := r.Selector.SelectRelevantChunks(goal, contextSelectModel)
 	if err != nil {
 		return err
 	}
 
-	var contextStr string
+	var pieces []contextPiece
 
 	// A. 必须包含的重要文件 (README 等)
 	for _, file := range r.Selector.FilesMustInclude {
 		// 防止与自动升格的文件重复
 		if _, alreadyPromoted := selectedCtx.FullFiles[file]; !alreadyPromoted {
-			contextStr += fmt.Sprintf("<File name=\"%s\"> \n%s </File>\n\n", file, utils.ReadFile(file))
+			pieces = append(pieces, contextPiece{text: fmt.Sprintf("<File name=\"%s\"> \n%s </File>\n\n", file, utils.ReadFile(file))})
 		}
 	}
 
 	// B. 自动升格的全量文件 (Scheme B Result)
 	for path, content := range selectedCtx.FullFiles {
-		contextStr += fmt.Sprintf("<File name=\"%s\"> \n%s </File>\n\n", path, content)
+		pieces = append(pieces, contextPiece{text: fmt.Sprintf("<File name=\"%s\"> \n%s </File>\n\n", path, content)})
 	}
 
 	// C. 剩余的零散 Chunks (包含被 Selector 注入了 READ-ONLY 注释的 Skeleton)
 	for _, c := range selectedCtx.Chunks {
-		contextStr += fmt.Sprintf("<Chunk id=\"%s\"> \n%s </Chunk>\n\n", c.ID, c.Body)
+		pieces = append(pieces, contextPiece{
+			text:     fmt.Sprintf("<Chunk id=\"%s\"> \n%s </Chunk>\n\n", c.ID, c.Body),
+			readOnly: strings.HasPrefix(c.Body, context.ReadOnlyBanner),
+		})
+	}
+
+	contextStr := joinPieces(pieces, nil)
+	if CodeImproveModel != nil {
+		if contextStr, err = r.fitContext(goal, pieces, CodeImproveModel); err != nil {
+			return err
+		}
 	}
 
 	// 保存到本地以便调试
@@ -107,10 +236,87 @@ func (r *GoalRunner) ExecuteGoal(goal string, contextSelectModel, CodeImproveMod
 		return nil
 	}
 
-	// 2. 调用生成
-	return r.EditorAgent.Call(map[string]any{
+	// 2. 调用生成，收集全部修改后整体应用
+	sol := models.NewSolution()
+	err = r.EditorAgent.Clone().UseTools(LLMToolApplyModification(sol)).Call(map[string]any{
 		agent.UseModel: CodeImproveModel,
 		"Goal":         goal,
 		"Context":      contextStr,
 	})
+	if err != nil {
+		return err
+	}
+	if r.DryRun {
+		_, err = previewSolution(sol)
+		return err
+	}
+
+	// 3. 应用并做编译校验，配置了验收条件时继续验收
+	applied, err := r.applyVerified(goal, CodeImproveModel, sol)
+	if err != nil || applied == nil || r.Acceptance == nil {
+		return err
+	}
+	return r.runAcceptance(selectedCtx.RunID, goal, CodeImproveModel, sol, applied)
+}
+
+// editorOutputReserve 为生成阶段的输出 (修改后的完整代码) 预留的 Token
+const editorOutputReserve = 8000
+
+// contextPiece 编辑上下文中的一个文件或 Chunk
+type contextPiece struct {
+	text     string
+	readOnly bool // 只读参考 (Skeleton / 裁剪后的文件头)，超出窗口时优先丢弃
+}
+
+// contextBudget 编辑模型窗口扣除提示模板与输出预留后，留给上下文的 Token
+func (r *GoalRunner) contextBudget(goal string, model *llm.Model) int {
+	overhead := model.CountTokens(r.EditorAgent.Messege(map[string]any{"Goal": goal, "Context": ""}))
+	return model.ContextTokens() - overhead - editorOutputReserve
+}
+
+// fitContext 使上下文放进模型窗口: 超出时按体积从大到小丢弃只读参考，仍超出则拒绝执行
+func (r *GoalRunner) fitContext(goal string, pieces []contextPiece, model *llm.Model) (string, error) {
+	budget := r.contextBudget(goal, model)
+
+	tokens := make([]int, len(pieces))
+	total := 0
+	for i, p := range pieces {
+		tokens[i] = model.CountTokens(p.text)
+		total += tokens[i]
+	}
+	if total <= budget {
+		return joinPieces(pieces, nil), nil
+	}
+
+	var readOnly []int
+	for i, p := range pieces {
+		if p.readOnly {
+			readOnly = append(readOnly, i)
+		}
+	}
+	sort.Slice(readOnly, func(a, b int) bool { return tokens[readOnly[a]] > tokens[readOnly[b]] })
+
+	dropped := make(map[int]bool)
+	for _, i := range readOnly {
+		if total <= budget {
+			break
+		}
+		dropped[i] = true
+		total -= tokens[i]
+	}
+	if total > budget {
+		return "", fmt.Errorf("context of %d tokens exceeds the %d-token budget of %s (window %d)", total, budget, model.Name, model.ContextTokens())
+	}
+	fmt.Printf("✂️ Context shrunk to %d tokens: dropped %d read-only chunks to fit %s\n", total, len(dropped), model.Name)
+	return joinPieces(pieces, dropped), nil
+}
+
+func joinPieces(pieces []contextPiece, dropped map[int]bool) string {
+	var sb strings.Builder
+	for i, p := range pieces {
+		if !dropped[i] {
+			sb.WriteString(p.text)
+		}
+	}
+	return sb.String()
 }
@@ -5,7 +5,6 @@ import (
 	"text/template"
 
 	"sysevov2/agent"
-	"sysevov2/editing"
 	"sysevov2/llm"
 	"sysevov2/models"
 	"sysevov2/utils"
@@ -15,6 +14,13 @@ import (
 type Merger struct {
 	MergerAgent                      *agent.Agent
 	LocalFileToSaveSelectedContextTo string
+	// DryRun 为 true 时不写文件，只输出合并结果的统一差异
+	DryRun bool
+}
+
+func (m *Merger) WithDryRun() *Merger {
+	m.DryRun = true
+	return m
 }
 
 func (m *Merger) WithLocalModel(model *llm.Model) *Merger {
@@ -44,6 +50,8 @@ func NewMerger() *Merger {
 1. TargetChunkID 必须与 Context 中提供的标识符完全匹配。
 2. NewContent 必须是完整的 AST 节点代码（包含函数签名和代码体）。
 3. 严禁修改没有提到的代码。
+4. 新增的声明使用 INSERT_BEFORE / INSERT_AFTER，以相邻的已有 Chunk 为 TargetChunkID，NewContent 只包含新声明；
+   改名使用 RENAME_SYMBOL，NewContent 只包含新名称，引用处会自动更新 (无法可靠解析引用时改名会被拒绝)。
 
 <Context>
 {{.Context}}
@@ -54,16 +62,8 @@ func NewMerger() *Merger {
 </CloudResponse>
 `))
 
-	// 创建 Merger Agent 并绑定已有的修改工具
-	// 注意：这里复用了 GoalRunner 中定义的 LLMToolApplyModification 逻辑
-	mergerAgent := agent.Create(t).WithToolCallMutextRun().
-		UseTools(llm.NewTool("ApplyModification", "Apply code modification", func(mod *models.CodeModification) {
-			if err := editing.ApplyModification(mod); err != nil {
-				fmt.Printf("❌ Merger failed to apply: %v\n", err)
-			} else {
-				fmt.Printf("✅ Merger applied change to: %s\n", mod.TargetChunkID)
-			}
-		})).WithModels(llm.ModelDefault)
+	// 创建 Merger Agent；修改工具复用 GoalRunner 中的 LLMToolApplyModification，在每次合并时绑定新的 Solution
+	mergerAgent := agent.Create(t).WithToolCallMutextRun().WithModels(llm.ModelDefault)
 
 	return &Merger{
 		MergerAgent: mergerAgent,
@@ -81,10 +81,19 @@ func (m *Merger) RunManualMerge() error {
 
 	fmt.Println("🧠 Local LLM is parsing cloud response and applying edits...")
 
-	// 2. 调用本地 Agent 解析并触发 ToolCall
-	err := m.MergerAgent.Call(map[string]any{
+	// 2. 调用本地 Agent 解析并触发 ToolCall，收集全部修改后整体应用
+	sol := models.NewSolution()
+	err := m.MergerAgent.Clone().UseTools(LLMToolApplyModification(sol)).Call(map[string]any{
 		"Context":       string(ctxBytes),
 		"CloudResponse": string(cloudBytes),
 	})
+	if err != nil {
+		return err
+	}
+	if m.DryRun {
+		_, err = previewSolution(sol)
+		return err
+	}
+	_, err = applySolution(sol)
 	return err
 }
@@ -0,0 +1,154 @@
+package workflow
+
+import (
+	"fmt"
+	"strings"
+
+	"sysevov2/agent"
+	"sysevov2/config"
+	"sysevov2/editing"
+	"sysevov2/llm"
+	"sysevov2/models"
+	"sysevov2/utils"
+
+	"github.com/samber/lo"
+)
+
+// appliedEdits 一次目标执行中已落盘的全部变更集 (首轮方案 + 各轮修复)
+type appliedEdits []*editing.Changeset
+
+func (a appliedEdits) paths() []string {
+	var paths []string
+	for _, cs := range a {
+		paths = append(paths, cs.Paths()...)
+	}
+	return lo.Uniq(paths)
+}
+
+// rollback 按应用的逆序撤销，每个变更集保存的是其应用前的内容，逆序恢复后回到执行前的状态
+func (a appliedEdits) rollback() {
+	for i := len(a) - 1; i >= 0; i-- {
+		if err := a[i].Rollback(); err != nil {
+			fmt.Printf("⚠️ %v\n", err)
+		}
+	}
+	fmt.Printf("↩️ Reverted %d edited files\n", len(a.paths()))
+}
+
+// applyVerified 原子地应用方案；config.Verify.Enabled 时做编译校验与修复
+// 返回本方案 (含修复) 落盘的变更集；修复失败时这些修改已全部回滚
+func (r *GoalRunner) applyVerified(goal string, model *llm.Model, sol *models.Solution) (appliedEdits, error) {
+	cs, err := stageSolution(sol)
+	if err != nil || cs == nil {
+		return nil, err
+	}
+	// 落盘前记录变更集涉及的全部文件 (含 RENAME_SYMBOL 改写的其他包中的引用方) 已存在的错误，只有新增的错误才进入修复
+	verify := config.Verify.Enabled
+	var baseline []editing.CompileError
+	if verify {
+		if baseline, err = editing.CheckFiles(cs.Paths()); err != nil {
+			fmt.Printf("⚠️ Compile verification unavailable: %v\n", err)
+			verify = false
+		}
+	}
+	if err := commitSolution(sol, cs); err != nil {
+		return nil, err
+	}
+	if !verify {
+		return appliedEdits{cs}, nil
+	}
+	return r.verifyAndRepair(goal, model, baseline, appliedEdits{cs})
+}
+
+// verifyAndRepair 对已应用的修改做编译校验；出现 baseline 之外的新错误时把错误与出错的 Chunk 交给编辑模型修复
+// 超过 MaxRepairRounds 仍有新错误时回滚 applied 及各轮修复并返回错误
+func (r *GoalRunner) verifyAndRepair(goal string, model *llm.Model, baseline []editing.CompileError, applied appliedEdits) (appliedEdits, error) {
+	for round := 0; ; round++ {
+		current, err := editing.CheckFiles(applied.paths())
+		if err != nil {
+			fmt.Printf("⚠️ Compile verification could not run, keeping edits: %v\n", err)
+			return applied, nil
+		}
+		fresh := editing.NewCompileErrors(baseline, current)
+		if len(fresh) == 0 {
+			fmt.Printf("✅ Compile check passed (%d repair rounds)\n", round)
+			return applied, nil
+		}
+		fmt.Printf("🔍 %d new compile errors after round %d\n", len(fresh), round)
+		if round >= r.MaxRepairRounds {
+			applied.rollback()
+			return nil, fmt.Errorf("edits reverted: %d compile errors remain after %d repair rounds:\n%s", len(fresh), round, formatCompileErrors(fresh))
+		}
+
+		sol := models.NewSolution()
+		err = r.EditorAgent.Clone().UseTools(LLMToolApplyModification(sol)).Call(map[string]any{
+			agent.UseModel: model,
+			"Goal":         repairGoal(goal, fresh),
+			"Context":      repairContext(fresh),
+		})
+		if err != nil {
+			fmt.Printf("❌ Repair round %d failed: %v\n", round+1, err)
+			continue
+		}
+		// 修复方案整体失败时不落盘，本轮计入预算，下一轮重新检查
+		cs, err := stageSolution(sol)
+		if err != nil || cs == nil {
+			continue
+		}
+		// 修复触及此前未校验的文件时，补记这些文件落盘前已存在的错误
+		if extra := lo.Without(cs.Paths(), applied.paths()...); len(extra) > 0 {
+			if existing, err := editing.CheckFiles(extra); err == nil {
+				baseline = append(baseline, existing...)
+			}
+		}
+		if err := commitSolution(sol, cs); err == nil {
+			applied = append(applied, cs)
+		}
+	}
+}
+
+func formatCompileErrors(errs []editing.CompileError) string {
+	var sb strings.Builder
+	for _, e := range errs {
+		sb.WriteString(e.String())
+		if e.ChunkID != "" {
+			fmt.Fprintf(&sb, " (in %s)", e.ChunkID)
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// repairGoal 在原目标后附上编译错误，要求只修复错误
+func repairGoal(goal string, errs []editing.CompileError) string {
+	return fmt.Sprintf("%s\n\nYour edits for this goal have been applied but no longer compile. "+
+		"Fix the following errors by modifying the chunks shown in the context, keeping the intended behavior:\n<CompileErrors>\n%s</CompileErrors>",
+		goal, formatCompileErrors(errs))
+}
+
+// repairContext 出错的 Chunk 以当前源码呈现；无法定位到 Chunk 的错误 (如 import) 呈现整个文件
+func repairContext(errs []editing.CompileError) string {
+	var sb strings.Builder
+	seen := make(map[string]bool)
+	for _, e := range errs {
+		if e.File == "" {
+			continue
+		}
+		if e.ChunkID != "" {
+			if seen[e.ChunkID] {
+				continue
+			}
+			seen[e.ChunkID] = true
+			if body, err := editing.ReadChunk(e.File, e.ChunkID); err == nil {
+				fmt.Fprintf(&sb, "<Chunk id=\"%s\"> \n%s </Chunk>\n\n", e.ChunkID, body)
+				continue
+			}
+		}
+		if seen[e.File] {
+			continue
+		}
+		seen[e.File] = true
+		fmt.Fprintf(&sb, "<File name=\"%s\"> \n%s </File>\n\n", e.File, utils.ReadFile(e.File))
+	}
+	return sb.String()
+}